@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"resizer/logger" //nolint:depguard
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	// maxRequestIDLength ограничивает идентификатор, пришедший от клиента.
+	maxRequestIDLength = 128
+)
+
+// requestInfo - сведения об обработке запроса, которые обработчик передает в журнал доступа.
+type requestInfo struct {
+	cache     string // hit, stale, miss или negative
+	origin    string // хост источника
+	transform string // запрошенный размер
+}
+
+type requestInfoKey struct{}
+
+// annotate возвращает сведения о запросе для журнала доступа. Если запрос не проходит
+// через журнал доступа, сведения никуда не попадут.
+func annotate(ctx context.Context) *requestInfo {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		return info
+	}
+	return &requestInfo{}
+}
+
+// withAccessLog присваивает запросу идентификатор, передает в контексте логгер запроса
+// и после обработки пишет о запросе одну строку в журнал.
+//
+// Идентификатор берется из заголовка X-Request-ID или создается, возвращается клиенту
+// и передается дальше в заголовках запроса, в том числе источнику изображения.
+func withAccessLog(logg *zap.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+			r.Header.Set(requestIDHeader, id)
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		reqLogger := logg.With(zap.String("requestId", id))
+		info := &requestInfo{}
+		ctx := logger.WithContext(r.Context(), reqLogger)
+		ctx = context.WithValue(ctx, requestInfoKey{}, info)
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		fields := []zap.Field{
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Int("status", rec.status),
+			zap.Int64("bytes", rec.bytes),
+			zap.Duration("duration", time.Since(start)),
+			zap.String("remoteAddr", r.RemoteAddr),
+		}
+		if info.cache != "" {
+			fields = append(fields, zap.String("cache", info.cache))
+		}
+		if info.origin != "" {
+			fields = append(fields, zap.String("origin", info.origin))
+		}
+		if info.transform != "" {
+			fields = append(fields, zap.String("transform", info.transform))
+		}
+		// Записи о запросах не прореживаются: у всех одно сообщение, и при большой нагрузке
+		// в журнал попадала бы лишь малая их часть
+		logger.Unsampled(reqLogger).Log(accessLogLevel(r, rec.status), "Request", fields...)
+	})
+}
+
+// accessLogLevel понижает уровень записей о проверках состояния, которые оркестратор
+// делает каждые несколько секунд, и повышает уровень записей об ошибках сервера.
+func accessLogLevel(r *http.Request, status int) zapcore.Level {
+	switch {
+	case r.URL.Path == "/healthz" || r.URL.Path == "/readyz":
+		return zapcore.DebugLevel
+	case status >= http.StatusInternalServerError:
+		return zapcore.ErrorLevel
+	default:
+		return zapcore.InfoLevel
+	}
+}
+
+// validRequestID проверяет, что идентификатор от клиента можно безопасно писать в журнал и заголовки.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// responseRecorder запоминает статус и размер ответа.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require" //nolint:depguard
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"resizer/logger" //nolint:depguard
+)
+
+func TestWithAccessLog(t *testing.T) {
+	origin, _ := slowOrigin(t, http.StatusOK, 0)
+	core, logs := observer.New(zapcore.DebugLevel)
+	handler := withAccessLog(zap.New(core), ResizeHandler(newTestResizer(t)))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/resize/20/10/"+origin.URL+"/image.png", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	id := rec.Header().Get(requestIDHeader)
+	require.Len(t, id, 32)
+
+	entries := logs.FilterMessage("Request").AllUntimed()
+	require.Len(t, entries, 1)
+	fields := entries[0].ContextMap()
+	require.Equal(t, id, fields["requestId"])
+	require.Equal(t, http.MethodGet, fields["method"])
+	require.Equal(t, int64(http.StatusOK), fields["status"])
+	require.Equal(t, int64(rec.Body.Len()), fields["bytes"])
+	require.Equal(t, "miss", fields["cache"])
+	require.Equal(t, origin.Listener.Addr().String(), fields["origin"])
+	require.Equal(t, "20x10", fields["transform"])
+	require.Contains(t, fields, "duration")
+
+	// Повторный запрос отдается из кэша
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/resize/20/10/"+origin.URL+"/image.png", nil))
+	entries = logs.FilterMessage("Request").AllUntimed()
+	require.Equal(t, "hit", entries[1].ContextMap()["cache"])
+}
+
+func TestWithAccessLog_requestID(t *testing.T) {
+	var received string
+	handler := withAccessLog(zap.NewNop(), http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(requestIDHeader)
+		// Логгер запроса доступен обработчику
+		require.NotSame(t, zap.L(), logger.FromContext(r.Context()))
+	}))
+
+	t.Run("propagated", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+		req.Header.Set(requestIDHeader, "abc-123")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		require.Equal(t, "abc-123", rec.Header().Get(requestIDHeader))
+		require.Equal(t, "abc-123", received)
+	})
+
+	t.Run("invalid is replaced", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+		req.Header.Set(requestIDHeader, "bad\x01id")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		id := rec.Header().Get(requestIDHeader)
+		require.NotEqual(t, "bad\x01id", id)
+		require.Equal(t, id, received)
+	})
+}
+
+func TestAccessLogLevel(t *testing.T) {
+	for path, tc := range map[string]struct {
+		status int
+		level  zapcore.Level
+	}{
+		"/resize/1/1/x": {http.StatusOK, zapcore.InfoLevel},
+		"/resize/2/2/x": {http.StatusGatewayTimeout, zapcore.ErrorLevel},
+		"/readyz":       {http.StatusServiceUnavailable, zapcore.DebugLevel},
+	} {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		require.Equal(t, tc.level, accessLogLevel(r, tc.status), path)
+	}
+}
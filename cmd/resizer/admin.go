@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+	"resizer/logger" //nolint:depguard
+)
+
+type purgeResponse struct {
+	Deleted int `json:"deleted"`
+}
+
+// PurgeHandler удаляет из кэша варианты изображений.
+//
+// Параметр url удаляет все варианты, полученные из указанного исходного изображения,
+// параметр prefix - все записи, ключ которых начинается с prefix.
+// При удалении по url удаляется и сохраненный оригинал, и запомненная ошибка источника.
+func PurgeHandler(rs *resizer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+			w.Header().Set("Allow", "POST, DELETE")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var deleted int
+		query := r.URL.Query()
+		switch {
+		case query.Get("url") != "":
+			rawURL, err := normalizeSourceURL(query.Get("url"))
+			if err != nil {
+				http.Error(w, "Invalid URL format", http.StatusBadRequest)
+				return
+			}
+			deleted = rs.purgeSource(GenerateHash(rawURL))
+			logger.FromContext(r.Context()).Info("Purged cached variants", zap.String("url", rawURL), zap.Int("deleted", deleted))
+		case query.Get("prefix") != "":
+			prefix := query.Get("prefix")
+			deleted = rs.cache.DeleteByPrefix(prefix)
+			logger.FromContext(r.Context()).Info("Purged cached variants", zap.String("prefix", prefix), zap.Int("deleted", deleted))
+		default:
+			http.Error(w, "Either url or prefix is required", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(purgeResponse{Deleted: deleted}); err != nil {
+			logger.FromContext(r.Context()).Error("Failed to write response", zap.Error(err))
+		}
+	}
+}
+
+// LogLevelHandler отдает (GET) и меняет (PUT с телом {"level":"debug"}) уровень логирования.
+func LogLevelHandler(level zap.AtomicLevel) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		before := level.Level()
+		level.ServeHTTP(w, r)
+		if after := level.Level(); after != before {
+			logger.FromContext(r.Context()).Warn("Log level changed",
+				zap.Stringer("from", before), zap.Stringer("to", after))
+		}
+	})
+}
+
+// requireToken пропускает только запросы с заголовком "Authorization: Bearer <token>".
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require" //nolint:depguard
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLogLevelHandler(t *testing.T) {
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	handler := requireToken("secret", LogLevelHandler(level))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/admin/log-level", strings.NewReader(`{"level":"debug"}`)))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Equal(t, zapcore.InfoLevel, level.Level())
+
+	req := httptest.NewRequest(http.MethodPut, "/admin/log-level", strings.NewReader(`{"level":"debug"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, zapcore.DebugLevel, level.Level())
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/log-level", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.JSONEq(t, `{"level":"debug"}`, rec.Body.String())
+}
+
+func TestPurgeHandler(t *testing.T) {
+	origin, hits := slowOrigin(t, http.StatusOK, 0)
+	rs := newTestResizer(t)
+	resize := ResizeHandler(rs)
+	purge := requireToken("secret", PurgeHandler(rs))
+	image1, image2 := origin.URL+"/image1.png", origin.URL+"/image2.png"
+
+	for _, path := range []string{"/resize/20/10/" + image1, "/resize/30/15/" + image1, "/resize/20/10/" + image2} {
+		require.Equal(t, http.StatusOK, getImage(resize, path).Code)
+	}
+	require.Equal(t, int32(3), hits.Load())
+
+	send := func(method, query, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/purge?"+query, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		purge.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Без токена или с чужим токеном ничего не удаляется
+	require.Equal(t, http.StatusUnauthorized, send(http.MethodPost, "url="+image1, "").Code)
+	require.Equal(t, http.StatusUnauthorized, send(http.MethodPost, "url="+image1, "wrong").Code)
+	rec := send(http.MethodGet, "url="+image1, "secret")
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	require.Equal(t, "POST, DELETE", rec.Header().Get("Allow"))
+	require.Equal(t, http.StatusBadRequest, send(http.MethodPost, "", "secret").Code)
+	require.Equal(t, http.StatusOK, getImage(resize, "/resize/20/10/"+image1).Code)
+	require.Equal(t, int32(3), hits.Load())
+
+	// Удаление по адресу источника удаляет все его варианты, и следующий запрос идет к источнику
+	rec = send(http.MethodPost, "url="+image1, "secret")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"deleted":2}`, rec.Body.String())
+	require.Equal(t, http.StatusOK, getImage(resize, "/resize/30/15/"+image1).Code)
+	require.Equal(t, int32(4), hits.Load())
+	require.Equal(t, http.StatusOK, getImage(resize, "/resize/20/10/"+image2).Code)
+	require.Equal(t, int32(4), hits.Load())
+
+	// Удаление по префиксу ключа
+	rec = send(http.MethodDelete, "prefix="+GenerateHash(image2), "secret")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"deleted":1}`, rec.Body.String())
+	require.Equal(t, http.StatusOK, getImage(resize, "/resize/20/10/"+image2).Code)
+	require.Equal(t, int32(5), hits.Load())
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra" //nolint:depguard
+	"resizer/config"         //nolint:depguard
+	"resizer/internal/cache" //nolint:depguard
+)
+
+// newCacheCommand создает команду "cache" для обслуживания дискового кэша без запуска сервера.
+func newCacheCommand(cfg *config.Config) *cobra.Command {
+	cacheCmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the on-disk cache",
+	}
+
+	cacheCmd.AddCommand(&cobra.Command{
+		Use:   "clear",
+		Short: "Remove every cached file from the configured cache directories",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			dirs := map[string]int{cfg.Storage.CacheDir: cfg.Storage.CacheSize}
+			if cfg.Storage.OriginalsCacheSize > 0 {
+				dirs[cfg.Storage.OriginalsCacheDir] = cfg.Storage.OriginalsCacheSize
+			}
+			for dir, size := range dirs {
+				c, err := cache.NewCache(size, dir, cacheKeys, legacyKeys)
+				if err != nil {
+					return fmt.Errorf("failed to open cache %s: %w", dir, err)
+				}
+				if err := c.Clear(); err != nil {
+					return fmt.Errorf("failed to clear cache %s: %w", dir, err)
+				}
+				cmd.Printf("Cache directory %s cleared\n", dir)
+			}
+			return nil
+		},
+	})
+
+	return cacheCmd
+}
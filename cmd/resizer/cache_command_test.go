@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require" //nolint:depguard
+	"resizer/config"                      //nolint:depguard
+	"resizer/internal/cache"              //nolint:depguard
+)
+
+func TestCacheClearCommand(t *testing.T) {
+	cfg := config.Default()
+	dir := t.TempDir()
+	cfg.Storage.CacheDir = filepath.Join(dir, "variants")
+	cfg.Storage.OriginalsCacheDir = filepath.Join(dir, "originals")
+
+	// Записи в поддиректориях, индекс, записи первых версий в корне и недописанный временный файл
+	hash := GenerateHash("http://example.com/image.png")
+	for _, cacheDir := range []string{cfg.Storage.CacheDir, cfg.Storage.OriginalsCacheDir} {
+		c, err := cache.NewCache(10, cacheDir, cacheKeys)
+		require.NoError(t, err)
+		require.NoError(t, c.Set(hash, []byte("original")))
+		require.NoError(t, c.Set(newVariant("http://example.com/image.png", 20, 10).cacheKey, []byte("variant")))
+		require.NoError(t, c.Flush())
+		require.NoError(t, os.WriteFile(filepath.Join(cacheDir, "20_10_"+hash), []byte("legacy"), 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(cacheDir, ".tmp-1-1"), []byte("partial"), 0o644))
+	}
+
+	cmd := newCacheCommand(cfg)
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"clear"})
+	require.NoError(t, cmd.Execute())
+
+	for _, cacheDir := range []string{cfg.Storage.CacheDir, cfg.Storage.OriginalsCacheDir} {
+		entries, err := os.ReadDir(cacheDir)
+		require.NoError(t, err)
+		require.Empty(t, entries, cacheDir)
+		require.Contains(t, out.String(), "Cache directory "+cacheDir+" cleared")
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra" //nolint:depguard
+	"resizer/config"         //nolint:depguard
+)
+
+// newConfigCommand создает команду "config" для проверки конфигурации без запуска сервера.
+func newConfigCommand(cfg *config.Config) *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the configuration",
+	}
+
+	configCmd.AddCommand(&cobra.Command{
+		Use:   "show",
+		Short: "Print the effective configuration after flags and RESIZER_* variables, with secrets redacted",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			data, err := cfg.YAML()
+			if err != nil {
+				return err
+			}
+			cmd.Printf("# %s\n%s", cfg.File, data)
+			return nil
+		},
+	})
+
+	configCmd.AddCommand(&cobra.Command{
+		Use:   "check",
+		Short: "Validate the configuration and list every invalid setting, exit with 1 if there are any",
+		Args:  cobra.NoArgs,
+		// Конфигурация загружается здесь, а не в корневой команде, чтобы вывести все ошибки
+		PersistentPreRunE: func(*cobra.Command, []string) error { return nil },
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			loaded, err := config.Load(cmd.Flags())
+			var invalid config.ValidationError
+			if errors.As(err, &invalid) {
+				for _, fe := range invalid {
+					cmd.PrintErrln(fe.Error())
+				}
+				return fmt.Errorf("%d invalid settings", len(invalid))
+			}
+			if err != nil {
+				return err
+			}
+			cmd.Printf("%s: ok\n", loaded.File)
+			return nil
+		},
+	})
+
+	return configCmd
+}
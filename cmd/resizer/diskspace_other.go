@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+
+package main
+
+import "math"
+
+// freeDiskSpace на этой платформе не поддерживается: свободное место считается неограниченным.
+func freeDiskSpace(string) (uint64, error) {
+	return math.MaxUint64, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Клиентские подсказки с плотностью пикселей экрана: современная и устаревшая.
+const (
+	dprHintHeader       = "Sec-CH-DPR"
+	legacyDPRHintHeader = "DPR"
+)
+
+var errInvalidDPR = errors.New("invalid DPR")
+
+// splitDPR отделяет от сегмента пути суффикс плотности: "200@2x" -> "200", "2x".
+func splitDPR(segment string) (value, dpr string) {
+	value, dpr, _ = strings.Cut(segment, "@")
+	return value, dpr
+}
+
+// requestDPR определяет множитель плотности пикселей запроса: из суффикса пути (@2x), параметра dpr
+// или, если они включены, из клиентских подсказок. Множитель ограничивается значением dpr.max и
+// округляется до десятых, чтобы не плодить почти одинаковые варианты.
+func (p *policy) requestDPR(r *http.Request, suffix string) (float64, error) {
+	query := r.URL.Query()
+	switch {
+	case suffix != "":
+		return parseDPR(suffix, p.maxDPR)
+	case query.Has("dpr"):
+		return parseDPR(query.Get("dpr"), p.maxDPR)
+	case p.clientHints:
+		// Подсказки присылает браузер, поэтому ошибка в них не повод отклонять запрос
+		if dpr, err := parseDPR(firstHeader(r.Header, dprHintHeader, legacyDPRHintHeader), p.maxDPR); err == nil {
+			return dpr, nil
+		}
+	}
+	return 1, nil
+}
+
+// parseDPR разбирает множитель вида 2, 2x или 1.5.
+func parseDPR(raw string, maxDPR float64) (float64, error) {
+	dpr, err := strconv.ParseFloat(strings.TrimSuffix(raw, "x"), 64)
+	if err != nil || math.IsNaN(dpr) || math.IsInf(dpr, 0) || dpr <= 0 {
+		return 0, fmt.Errorf("%w: %q", errInvalidDPR, raw)
+	}
+	dpr = math.Round(math.Min(math.Max(dpr, 1), maxDPR)*10) / 10
+	return dpr, nil
+}
+
+// firstHeader возвращает первый непустой заголовок из names.
+func firstHeader(h http.Header, names ...string) string {
+	for _, name := range names {
+		if v := strings.TrimSpace(h.Get(name)); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// setClientHintHeaders просит браузер присылать плотность пикселей и сообщает кэшам,
+// что ответ от нее зависит.
+func setClientHintHeaders(w http.ResponseWriter) {
+	w.Header().Set("Accept-CH", dprHintHeader+", "+legacyDPRHintHeader)
+	w.Header().Add("Vary", dprHintHeader+", "+legacyDPRHintHeader)
+}
+
+// scaleDPR умножает запрошенные размеры на dpr, но так, чтобы результат не превышал исходное
+// изображение srcWidth x srcHeight: увеличенная копия не содержит новых деталей. Ниже запрошенных
+// размеров множитель не опускается. Нулевой размер остается нулевым.
+func scaleDPR(width, height int, dpr float64, srcWidth, srcHeight int) (int, int) {
+	if dpr <= 1 {
+		return width, height
+	}
+	scale := dpr
+	if width > 0 && float64(width)*scale > float64(srcWidth) {
+		scale = float64(srcWidth) / float64(width)
+	}
+	if height > 0 && float64(height)*scale > float64(srcHeight) {
+		scale = float64(srcHeight) / float64(height)
+	}
+	if scale <= 1 {
+		return width, height
+	}
+	return int(math.Round(float64(width) * scale)), int(math.Round(float64(height) * scale))
+}
+
+// dprSuffix возвращает часть ключа кэша с множителем; для 1 - пустую строку.
+func dprSuffix(dpr float64) string {
+	if dpr <= 1 {
+		return ""
+	}
+	return "@" + strconv.FormatFloat(dpr, 'f', -1, 64) + "x"
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require" //nolint:depguard
+	"resizer/config"                      //nolint:depguard
+)
+
+func TestParseDPR(t *testing.T) {
+	for raw, want := range map[string]float64{"2": 2, "2x": 2, "1.5": 1.5, "1.26": 1.3, "0.5": 1, "10": 3} {
+		dpr, err := parseDPR(raw, 3)
+		require.NoError(t, err, raw)
+		require.Equal(t, want, dpr, raw)
+	}
+	for _, raw := range []string{"", "x", "abc", "-1", "0", "NaN", "Inf"} {
+		_, err := parseDPR(raw, 3)
+		require.ErrorIs(t, err, errInvalidDPR, raw)
+	}
+}
+
+func TestScaleDPR(t *testing.T) {
+	w, h := scaleDPR(100, 50, 2, 1000, 1000)
+	require.Equal(t, []int{200, 100}, []int{w, h})
+
+	// Увеличение ограничено размером источника, но не опускается ниже запрошенного
+	w, h = scaleDPR(300, 100, 3, 600, 1000)
+	require.Equal(t, []int{600, 200}, []int{w, h})
+	w, h = scaleDPR(800, 100, 2, 600, 1000)
+	require.Equal(t, []int{800, 100}, []int{w, h})
+
+	w, h = scaleDPR(100, 0, 2, 1000, 1000)
+	require.Equal(t, []int{200, 0}, []int{w, h})
+}
+
+func TestRequestDPR(t *testing.T) {
+	cfg := config.Default()
+	p := newPolicy(cfg)
+
+	r := httptest.NewRequest(http.MethodGet, "/resize/10/10/example.com/a.png?dpr=2", nil)
+	dpr, err := p.requestDPR(r, "")
+	require.NoError(t, err)
+	require.Equal(t, 2.0, dpr)
+
+	// Суффикс пути важнее параметра
+	dpr, err = p.requestDPR(r, "3x")
+	require.NoError(t, err)
+	require.Equal(t, 3.0, dpr)
+
+	// Подсказки учитываются, только если включены
+	r = httptest.NewRequest(http.MethodGet, "/resize/10/10/example.com/a.png", nil)
+	r.Header.Set("Sec-CH-DPR", "2")
+	dpr, err = p.requestDPR(r, "")
+	require.NoError(t, err)
+	require.Equal(t, 1.0, dpr)
+
+	cfg.DPR.ClientHints = true
+	p = newPolicy(cfg)
+	dpr, err = p.requestDPR(r, "")
+	require.NoError(t, err)
+	require.Equal(t, 2.0, dpr)
+
+	r.Header.Set("Sec-CH-DPR", "garbage")
+	dpr, err = p.requestDPR(r, "")
+	require.NoError(t, err)
+	require.Equal(t, 1.0, dpr)
+}
+
+func TestResizeHandler_dpr(t *testing.T) {
+	origin, _ := slowOrigin(t, http.StatusOK, 0)
+	rs := newTestResizer(t)
+	cfg := config.Default()
+	cfg.DPR.ClientHints = true
+	rs.setPolicy(newPolicy(cfg))
+	handler := ResizeHandler(rs)
+
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	bounds := func(rec *httptest.ResponseRecorder) image.Rectangle {
+		require.Equal(t, http.StatusOK, rec.Code)
+		img, _, err := image.Decode(rec.Body)
+		require.NoError(t, err)
+		return img.Bounds()
+	}
+
+	// Источник 40x20
+	require.Equal(t, image.Rect(0, 0, 20, 10), bounds(get("/resize/10/5@2x/"+origin.URL+"/image.png", nil)))
+	require.Equal(t, image.Rect(0, 0, 40, 13), bounds(get("/resize/30/10/"+origin.URL+"/image.png?dpr=3", nil)))
+
+	rec := get("/resize/10/5/"+origin.URL+"/image.png", http.Header{"Sec-Ch-Dpr": {"2"}})
+	require.Equal(t, "Sec-CH-DPR, DPR", rec.Header().Get("Vary"))
+	require.Equal(t, image.Rect(0, 0, 20, 10), bounds(rec))
+	// Вариант без множителя хранится отдельно
+	require.Equal(t, image.Rect(0, 0, 10, 5), bounds(get("/resize/10/5/"+origin.URL+"/image.png", nil)))
+
+	require.Equal(t, http.StatusBadRequest, get("/resize/10/5@abc/"+origin.URL+"/image.png", nil).Code)
+}
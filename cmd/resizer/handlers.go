@@ -1,24 +1,186 @@
 package main
 
 import (
+	"cmp"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	goimage "image"
 	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"go.opentelemetry.io/otel"           //nolint:depguard
+	"go.opentelemetry.io/otel/attribute" //nolint:depguard
+	"go.opentelemetry.io/otel/codes"     //nolint:depguard
+	"go.opentelemetry.io/otel/trace"     //nolint:depguard
 	"go.uber.org/zap"
-	"resizer/internal/cache" //nolint:depguard
-	"resizer/internal/image" //nolint:depguard
+	"resizer/config"                //nolint:depguard
+	"resizer/internal/cache"        //nolint:depguard
+	"resizer/internal/image"        //nolint:depguard
+	"resizer/internal/limiter"      //nolint:depguard
+	"resizer/internal/metrics"      //nolint:depguard
+	"resizer/internal/singleflight" //nolint:depguard
+	"resizer/internal/upstream"     //nolint:depguard
+	"resizer/logger"                //nolint:depguard
 )
 
 var slashRegex = regexp.MustCompile(`^/+`)
 
-// ResizeHandler обрабатывает запросы на изменение размера изображений.
-func ResizeHandler(lruCache cache.Cache, logg *zap.Logger) http.HandlerFunc {
+var tracer = otel.Tracer("resizer/cmd/resizer")
+
+// Имена кэшей в метриках и трассах.
+const (
+	variantsCache  = "variants"
+	originalsCache = "originals"
+)
+
+var (
+	errDownload = errors.New("failed to download image")
+	errResize   = errors.New("failed to resize image")
+	errTooLarge = errors.New("image size is too large")
+)
+
+// resizer содержит зависимости обработчиков ресайза.
+type resizer struct {
+	cache      cache.Cache
+	limiter    *limiter.Limiter
+	fetcher    fetcher
+	metrics    *metrics.Metrics     // может быть nil
+	originals  cache.Cache          // исходные изображения по хэшу источника, может быть nil
+	negative   *cache.NegativeCache // ошибки источников, может быть nil
+	policy     atomic.Pointer[policy]
+	flights    singleflight.Group // одновременные запросы одного варианта
+	refreshing sync.Map           // ключи, для которых уже идет фоновое обновление
+	background sync.WaitGroup     // фоновые обновления, которых нужно дождаться при остановке
+}
+
+// policy - настройки обработки запросов, которые меняются без перезапуска.
+type policy struct {
+	defaultTTL     time.Duration
+	defaultQuality int
+	retryAfter     string
+	presets        map[string]config.PresetConfig
+	presetsOnly    bool // произвольные размеры запрещены
+	maxDimension   int  // наибольшая ширина или высота результата, 0 - без ограничения
+	maxDPR         float64
+	clientHints    bool // множитель берется из заголовков Sec-CH-DPR и DPR
+}
+
+// tooLarge проверяет, что результат размером width x height превышает maxDimension.
+func (p *policy) tooLarge(width, height int) bool {
+	return p.maxDimension > 0 && (width > p.maxDimension || height > p.maxDimension)
+}
+
+func newPolicy(cfg *config.Config) *policy {
+	presets := make(map[string]config.PresetConfig, len(cfg.Presets))
+	for name, p := range cfg.Presets {
+		p.Mode = cmp.Or(p.Mode, image.ModeResize)
+		if p.Mode == image.ModeFill {
+			p.Gravity = cmp.Or(p.Gravity, "center")
+		}
+		p.Quality = cmp.Or(p.Quality, cfg.Storage.DefaultImageQuality)
+		presets[name] = p
+	}
+	return &policy{
+		defaultTTL:     time.Duration(cfg.Storage.DefaultTTL) * time.Second,
+		defaultQuality: cfg.Storage.DefaultImageQuality,
+		retryAfter:     strconv.Itoa(cfg.Limits.RetryAfter),
+		presets:        presets,
+		presetsOnly:    cfg.Limits.PresetsOnly,
+		maxDimension:   cfg.Limits.MaxDimension,
+		maxDPR:         cfg.DPR.Max,
+		clientHints:    cfg.DPR.ClientHints,
+	}
+}
+
+// fetcher загружает исходные изображения с источников.
+type fetcher interface {
+	Fetch(ctx context.Context, url string, headers http.Header) ([]byte, http.Header, error)
+}
+
+// variant описывает запрошенный вариант изображения.
+type variant struct {
+	width, height int     // 0 - по пропорциям исходного изображения, оба 0 - исходный размер
+	mode, gravity string  // режим масштабирования и точка привязки обрезки, см. image.Resize
+	quality       int     // качество JPEG, 0 - по умолчанию
+	format        string  // формат результата, пустой - формат источника
+	dpr           float64 // множитель размеров для экранов высокой плотности, 0 и 1 - без увеличения
+	sourceURL     string
+	sourceHash    string
+	cacheKey      string
+}
+
+// newVariant описывает вариант изображения rawURL размером width x height.
+// Хэш источника в начале ключа позволяет удалить все варианты изображения по префиксу.
+func newVariant(rawURL string, width, height int) variant {
+	hash := GenerateHash(rawURL)
+	return variant{
+		width:      width,
+		height:     height,
+		sourceURL:  rawURL,
+		sourceHash: hash,
+		cacheKey:   fmt.Sprintf("%s_%d_%d", hash, width, height),
+	}
+}
+
+// setDPR задает множитель размеров; варианты с разными множителями хранятся под разными ключами.
+func (v *variant) setDPR(dpr float64) {
+	v.dpr = dpr
+	v.cacheKey += dprSuffix(dpr)
+}
+
+// presetVariant описывает вариант изображения rawURL по пресету p. Параметры пресета входят
+// в ключ, поэтому после изменения пресета варианты создаются заново.
+func presetVariant(rawURL string, p config.PresetConfig) variant {
+	v := newVariant(rawURL, p.Width, p.Height)
+	v.mode, v.gravity, v.quality, v.format = p.Mode, p.Gravity, p.Quality, p.Format
+	v.cacheKey += fmt.Sprintf("_%s_%s_q%d_%s", p.Mode, p.Gravity, p.Quality, cmp.Or(p.Format, "source"))
+	return v
+}
+
+func newResizer(
+	variants, originals cache.Cache,
+	negative *cache.NegativeCache,
+	lim *limiter.Limiter,
+	f fetcher,
+	m *metrics.Metrics,
+	cfg *config.Config,
+) *resizer {
+	rs := &resizer{
+		cache:     variants,
+		limiter:   lim,
+		fetcher:   f,
+		metrics:   m,
+		originals: originals,
+		negative:  negative,
+	}
+	rs.setPolicy(newPolicy(cfg))
+	return rs
+}
+
+// setPolicy заменяет настройки обработки. Запросы, которые уже обрабатываются, могут
+// закончиться со старыми настройками.
+func (rs *resizer) setPolicy(p *policy) {
+	rs.policy.Store(p)
+}
+
+// ResizeHandler обрабатывает запросы на изменение размера изображений: /resize/{width}/{height}/{url}.
+func ResizeHandler(rs *resizer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		p := rs.policy.Load()
+		if p.presetsOnly {
+			http.Error(w, "Only presets are allowed", http.StatusForbidden)
+			return
+		}
+
 		// Удаляем префикс "/resize/"
 		path := strings.TrimPrefix(r.URL.Path, "/resize/")
 		// Разделяем путь на части по первым двум слешам
@@ -28,70 +190,465 @@ func ResizeHandler(lruCache cache.Cache, logg *zap.Logger) http.HandlerFunc {
 			return
 		}
 
-		width, height, rawURL := parts[0], parts[1], parts[2]
-
-		// Парсим URL для корректной обработки
-		parsedURL, err := url.Parse(rawURL)
+		rawURL, err := normalizeSourceURL(parts[2])
 		if err != nil {
 			http.Error(w, "Invalid URL format", http.StatusBadRequest)
 			return
 		}
 
-		// Удаляем лишние слеши в начале URL
-		parsedURL.Path = slashRegex.ReplaceAllString(parsedURL.Path, "")
-		rawURL = "http://" + parsedURL.Path
-
-		// Генерируем хэш от URL
-		urlHash := GenerateHash(parsedURL.String())
+		rawHeight, suffix := splitDPR(parts[1])
+		width, errWidth := parseDimension(parts[0])
+		height, errHeight := parseDimension(rawHeight)
+		if errWidth != nil || errHeight != nil {
+			http.Error(w, "Invalid image size", http.StatusBadRequest)
+			return
+		}
+		if p.tooLarge(width, height) {
+			http.Error(w, "Image size is too large", http.StatusBadRequest)
+			return
+		}
+		dpr, err := p.requestDPR(r, suffix)
+		if err != nil {
+			http.Error(w, "Invalid DPR", http.StatusBadRequest)
+			return
+		}
+		if p.clientHints {
+			setClientHintHeaders(w)
+		}
 
-		// Генерируем ключ для кэша
-		cacheKey := fmt.Sprintf("%s_%s_%s", width, height, urlHash)
+		v := newVariant(rawURL, width, height)
+		v.quality = p.defaultQuality
+		v.setDPR(dpr)
+		annotate(r.Context()).transform = fmt.Sprintf("%dx%d%s", v.width, v.height, dprSuffix(dpr))
+		rs.serve(w, r, v)
+	}
+}
 
-		// Проверяем наличие в кэше
-		if data, ok := lruCache.Get(cacheKey); ok {
-			format := cacheKey[strings.LastIndex(cacheKey, "_")+1:] // Извлекаем формат из ключа
-			w.Header().Set("Content-Type", getContentType(format))
-			_, err := w.Write(data)
-			if err != nil {
-				logg.Error(fmt.Sprintf("Failed to write response: %v", err))
-			}
+// PresetHandler отдает варианты изображений по пресетам из конфигурации: /preset/{name}/{url}.
+func PresetHandler(rs *resizer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/preset/")
+		parts := strings.SplitN(path, "/", 2)
+		if len(parts) < 2 {
+			http.Error(w, "Invalid URL format", http.StatusBadRequest)
 			return
 		}
 
-		// Загружаем и обрабатываем изображение
-		data, err := image.DownloadImage(rawURL, r.Header) // Передаем заголовки исходного запроса
+		p := rs.policy.Load()
+		name, suffix := splitDPR(parts[0])
+		preset, ok := p.presets[name]
+		if !ok {
+			http.Error(w, "Unknown preset", http.StatusNotFound)
+			return
+		}
+		dpr, err := p.requestDPR(r, suffix)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to download image: %s", rawURL), http.StatusInternalServerError)
+			http.Error(w, "Invalid DPR", http.StatusBadRequest)
 			return
 		}
+		if p.clientHints {
+			setClientHintHeaders(w)
+		}
 
-		resizedData, format, err := image.ResizeImage(data, atoi(width), atoi(height))
+		rawURL, err := normalizeSourceURL(parts[1])
 		if err != nil {
-			http.Error(w, "Failed to resize image", http.StatusInternalServerError)
+			http.Error(w, "Invalid URL format", http.StatusBadRequest)
 			return
 		}
 
-		// Сохраняем в кэш
-		if err := lruCache.Set(cacheKey, resizedData); err != nil {
-			logg.Error(fmt.Sprintf("Failed to cache image: %v", err))
+		v := presetVariant(rawURL, preset)
+		v.setDPR(dpr)
+		annotate(r.Context()).transform = "preset:" + name + dprSuffix(dpr)
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("image.preset", name))
+		rs.serve(w, r, v)
+	}
+}
+
+// serve отдает вариант изображения из кэша или создает его.
+func (rs *resizer) serve(w http.ResponseWriter, r *http.Request, v variant) {
+	info := annotate(r.Context())
+	info.origin = originHost(v.sourceURL)
+	span := trace.SpanFromContext(r.Context())
+	span.SetAttributes(
+		attribute.String("image.source", v.sourceURL),
+		attribute.Int("image.width", v.width),
+		attribute.Int("image.height", v.height),
+		attribute.Float64("image.dpr", max(v.dpr, 1)),
+	)
+
+	// Проверяем наличие в кэше
+	if entry, state := rs.lookup(r.Context(), variantsCache, rs.cache, v.cacheKey); state != cache.Miss {
+		info.cache = "hit"
+		if state == cache.Stale {
+			// Отдаем устаревшую запись сразу, а обновляем её в фоне
+			info.cache = "stale"
+			rs.revalidate(r.Context(), v, r.Header.Clone())
 		}
 
-		// Возвращаем изображение
-		w.Header().Set("Content-Type", getContentType(format))
-		_, err = w.Write(resizedData)
+		w.Header().Set("Content-Type", http.DetectContentType(entry.Data))
+		_, err := w.Write(entry.Data)
 		if err != nil {
-			logg.Error(fmt.Sprintf("Failed to write response: %v", err))
+			logger.FromContext(r.Context()).Error("Failed to write response", zap.Error(err))
+		}
+		return
+	}
+
+	// Источник недавно ответил ошибкой - отдаем её, не обращаясь к нему снова
+	if status, ok := rs.negativeStatus(v); ok {
+		info.cache = "negative"
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	info.cache = "miss"
+
+	// Загружаем и обрабатываем изображение, передавая заголовки исходного запроса
+	resizedData, format, err := rs.renderShared(r.Context(), v, r.Header)
+	if err != nil {
+		recordError(span, err)
+		rs.writeError(r.Context(), w, v, err)
+		return
+	}
+
+	// Возвращаем изображение
+	w.Header().Set("Content-Type", getContentType(format))
+	_, err = w.Write(resizedData)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("Failed to write response", zap.Error(err))
+	}
+}
+
+// render получает исходное изображение, изменяет его размер и сохраняет результат в кэш.
+// Срок годности берется из заголовков ответа источника, а при их отсутствии - из defaultTTL.
+func (rs *resizer) render(ctx context.Context, v variant, headers http.Header) ([]byte, string, error) {
+	data, expiry, err := rs.original(ctx, v, headers)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", errDownload, err)
+		rs.rememberFailure(v, err)
+		return nil, "", err
+	}
+
+	resizedData, format, err := rs.resize(ctx, data, v)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", errResize, err)
+		rs.rememberFailure(v, err)
+		return nil, "", err
+	}
+
+	if err := rs.store(ctx, variantsCache, rs.cache, v.cacheKey, resizedData, expiry); err != nil {
+		logger.FromContext(ctx).Error("Failed to cache image", zap.String("key", v.cacheKey), zap.Error(err))
+	}
+
+	return resizedData, format, nil
+}
+
+// resize изменяет размер изображения, дождавшись места в ограничителе. Бюджет пикселей расходуется
+// по большему из исходного изображения, которое придется декодировать, и результата.
+func (rs *resizer) resize(ctx context.Context, data []byte, v variant) ([]byte, string, error) {
+	width, height, err := image.Dimensions(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Недостающий размер вычисляется по пропорциям и может оказаться слишком большим
+	targetWidth, targetHeight := scaleDPR(v.width, v.height, v.dpr, width, height)
+	outWidth, outHeight := image.Size(width, height, targetWidth, targetHeight)
+	if rs.policy.Load().tooLarge(outWidth, outHeight) {
+		return nil, "", fmt.Errorf("%w: %dx%d", errTooLarge, outWidth, outHeight)
+	}
+
+	pixels := max(int64(width)*int64(height), int64(outWidth)*int64(outHeight))
+	release, err := rs.limiter.Acquire(ctx, pixels)
+	if err != nil {
+		return nil, "", err
+	}
+	defer release()
+
+	// Пока запрос ждал в очереди, клиент мог уйти - тогда декодировать уже незачем
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var (
+		img     goimage.Image
+		format  string
+		encoded []byte
+	)
+	err = rs.stage(ctx, metrics.StageDecode, func(ctx context.Context, span trace.Span) error {
+		img, format, err = image.Decode(ctx, data)
+		span.SetAttributes(
+			attribute.String("image.format", format),
+			attribute.Int("image.source.width", width),
+			attribute.Int("image.source.height", height),
+		)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	_ = rs.stage(ctx, metrics.StageResize, func(ctx context.Context, span trace.Span) error {
+		img = image.Resize(ctx, img, targetWidth, targetHeight, v.mode, v.gravity)
+		span.SetAttributes(
+			attribute.Int("image.width", img.Bounds().Dx()),
+			attribute.Int("image.height", img.Bounds().Dy()),
+		)
+		return nil
+	})
+
+	if v.format != "" {
+		format = v.format
+	}
+	err = rs.stage(ctx, metrics.StageEncode, func(ctx context.Context, span trace.Span) error {
+		encoded, err = image.Encode(ctx, img, format, v.quality)
+		span.SetAttributes(attribute.Int("image.size", len(encoded)))
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return encoded, format, nil
+}
+
+// stage выполняет стадию обработки изображения в отдельном span и учитывает ее длительность в метриках.
+func (rs *resizer) stage(ctx context.Context, name string, fn func(ctx context.Context, span trace.Span) error) error {
+	ctx, span := tracer.Start(ctx, "image."+name)
+	defer span.End()
+
+	start := time.Now()
+	if err := fn(ctx, span); err != nil {
+		recordError(span, err)
+		return err
+	}
+	rs.metrics.ObserveStage(name, time.Since(start))
+	return nil
+}
+
+type rendered struct {
+	data   []byte
+	format string
+}
+
+// renderShared выполняет render один раз для всех одновременных запросов одного варианта:
+// остальные запросы дожидаются результата (или ошибки) первого. Заголовки источнику
+// передаются от запроса, начавшего обработку. Обработка прерывается, только когда
+// результата перестали ждать все запросы.
+func (rs *resizer) renderShared(ctx context.Context, v variant, headers http.Header) ([]byte, string, error) {
+	res, err, _ := rs.flights.DoContext(ctx, v.cacheKey, func(ctx context.Context) (interface{}, error) {
+		data, format, err := rs.render(ctx, v, headers)
+		return rendered{data: data, format: format}, err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	r := res.(rendered)
+	return r.data, r.format, nil
+}
+
+// original возвращает исходное изображение: свежее из хранилища оригиналов или загруженное
+// с источника. Новые варианты известного изображения рендерятся без обращения к источнику.
+func (rs *resizer) original(ctx context.Context, v variant, headers http.Header) ([]byte, time.Time, error) {
+	if rs.originals != nil {
+		if entry, state := rs.lookup(ctx, originalsCache, rs.originals, v.sourceHash); state == cache.Fresh {
+			return entry.Data, entry.ExpiresAt, nil
+		}
+	}
+
+	data, respHeader, err := rs.fetcher.Fetch(ctx, v.sourceURL, headers)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var expiry time.Time
+	ttl, ok := image.CacheTTL(respHeader, time.Now())
+	if !ok {
+		ttl = rs.policy.Load().defaultTTL
+	}
+	if ok || ttl != 0 {
+		expiry = time.Now().Add(ttl)
+	}
+
+	if rs.originals != nil {
+		if err := rs.store(ctx, originalsCache, rs.originals, v.sourceHash, data, expiry); err != nil {
+			logger.FromContext(ctx).Error("Failed to cache original image", zap.String("key", v.sourceHash), zap.Error(err))
 		}
 	}
+	return data, expiry, nil
+}
+
+// lookup ищет запись в кэше c с именем name.
+func (rs *resizer) lookup(ctx context.Context, name string, c cache.Cache, key string) (cache.Entry, cache.State) {
+	_, span := tracer.Start(ctx, "cache.lookup", trace.WithAttributes(
+		attribute.String("cache.name", name),
+		attribute.String("cache.key", key),
+	))
+	defer span.End()
+
+	entry, state := c.Lookup(key)
+	span.SetAttributes(attribute.String("cache.state", state.String()))
+	return entry, state
 }
 
-func atoi(s string) int {
-	var n int
-	_, err := fmt.Sscanf(s, "%d", &n)
+// store сохраняет данные в кэш c с именем name до момента expiry; нулевой expiry означает бессрочную запись.
+func (rs *resizer) store(
+	ctx context.Context, name string, c cache.Cache, key string, data []byte, expiry time.Time,
+) error {
+	_, span := tracer.Start(ctx, "cache.set", trace.WithAttributes(
+		attribute.String("cache.name", name),
+		attribute.String("cache.key", key),
+		attribute.Int("cache.size", len(data)),
+	))
+	defer span.End()
+
+	var err error
+	if expiry.IsZero() {
+		err = c.Set(key, data)
+	} else {
+		err = c.SetWithTTL(key, data, time.Until(expiry))
+	}
 	if err != nil {
-		return 0
+		recordError(span, err)
+	}
+	return err
+}
+
+// purgeSource удаляет все варианты исходного изображения, сам оригинал и запомненную ошибку.
+func (rs *resizer) purgeSource(sourceHash string) int {
+	if rs.negative != nil {
+		rs.negative.Delete(sourceHash)
+	}
+	if rs.originals != nil {
+		rs.originals.Delete(sourceHash)
 	}
-	return n
+	return rs.cache.DeleteByPrefix(sourceHash + "_")
+}
+
+// revalidate обновляет устаревший вариант в фоне. Одновременно для ключа выполняется
+// не больше одного обновления. Обновление попадает в трассу запроса, который его запустил.
+func (rs *resizer) revalidate(ctx context.Context, v variant, headers http.Header) {
+	if _, loaded := rs.refreshing.LoadOrStore(v.cacheKey, struct{}{}); loaded {
+		return
+	}
+	rs.background.Add(1)
+	go func() {
+		defer rs.background.Done()
+		defer rs.refreshing.Delete(v.cacheKey)
+		// Обновление не связано с запросом, который его запустил, и не прерывается вместе с ним
+		ctx := context.WithoutCancel(ctx)
+		if _, _, err := rs.renderShared(ctx, v, headers); err != nil {
+			logger.FromContext(ctx).Error("Failed to revalidate", zap.String("key", v.cacheKey), zap.Error(err))
+		}
+	}()
+}
+
+// rememberFailure запоминает ошибки, которые не исчезнут при повторном запросе:
+// изображение не найдено или источник отдает не изображение.
+func (rs *resizer) rememberFailure(v variant, err error) {
+	if rs.negative == nil {
+		return
+	}
+	switch status := errorStatus(err); status {
+	case http.StatusNotFound, http.StatusGone, http.StatusUnsupportedMediaType:
+		rs.negative.Add(v.sourceHash, status)
+	}
+}
+
+func (rs *resizer) negativeStatus(v variant) (int, bool) {
+	if rs.negative == nil {
+		return 0, false
+	}
+	return rs.negative.Get(v.sourceHash)
+}
+
+func (rs *resizer) writeError(ctx context.Context, w http.ResponseWriter, v variant, err error) {
+	status := errorStatus(err)
+	retryAfter := rs.policy.Load().retryAfter
+	switch {
+	case errors.Is(err, context.Canceled):
+		// Клиент ушел - отвечать некому
+		logger.FromContext(ctx).Debug("Client disconnected while processing", zap.String("key", v.cacheKey))
+	case errors.Is(err, upstream.ErrCircuitOpen):
+		// Источник недоступен - не ждем его, а просим клиента повторить запрос позже
+		w.Header().Set("Retry-After", retryAfter)
+		http.Error(w, "Origin is unavailable, try again later", status)
+	case status == http.StatusServiceUnavailable:
+		// Сервер перегружен - просим клиента повторить запрос позже
+		w.Header().Set("Retry-After", retryAfter)
+		http.Error(w, "Server is busy, try again later", status)
+	case errors.Is(err, errTooLarge):
+		http.Error(w, "Image size is too large", status)
+	case status != http.StatusInternalServerError:
+		http.Error(w, http.StatusText(status), status)
+	case errors.Is(err, errDownload):
+		http.Error(w, fmt.Sprintf("Failed to download image: %s", v.sourceURL), status)
+	default:
+		http.Error(w, "Failed to resize image", status)
+	}
+}
+
+// recordError отмечает span как завершившийся ошибкой.
+func recordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// errorStatus определяет HTTP-статус ответа клиенту по ошибке обработки.
+func errorStatus(err error) int {
+	var statusErr *upstream.StatusError
+	switch {
+	case errors.As(err, &statusErr) &&
+		(statusErr.StatusCode == http.StatusNotFound || statusErr.StatusCode == http.StatusGone):
+		return statusErr.StatusCode
+	case errors.Is(err, image.ErrNotImage):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, errTooLarge):
+		return http.StatusBadRequest
+	case errors.Is(err, limiter.ErrQueueFull), errors.Is(err, upstream.ErrCircuitOpen):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		// Истек таймаут загрузки или общий срок обработки запроса
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// originHost возвращает хост источника из нормализованного адреса.
+func originHost(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Host
+	}
+	return ""
+}
+
+// normalizeSourceURL приводит адрес исходного изображения к виду http://host/path.
+// Адрес может прийти как с двумя слешами после схемы, так и с одним (после очистки пути в ServeMux)
+// или вовсе без схемы.
+func normalizeSourceURL(rawURL string) (string, error) {
+	// Парсим URL для корректной обработки
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	// Удаляем лишние слеши в начале URL
+	path := slashRegex.ReplaceAllString(parsedURL.Host+parsedURL.Path, "")
+	if path == "" {
+		return "", fmt.Errorf("empty source URL: %q", rawURL)
+	}
+	return "http://" + path, nil
+}
+
+// parseDimension разбирает ширину или высоту из адреса. Пустое значение и 0 означают, что размер
+// вычисляется по пропорциям исходного изображения.
+func parseDimension(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid image size %q", s)
+	}
+	return n, nil
 }
 
 func getContentType(format string) string {
@@ -112,3 +669,51 @@ func GenerateHash(input string) string {
 	hash := sha256.Sum256([]byte(input))
 	return hex.EncodeToString(hash[:])
 }
+
+// isCacheKey проверяет, что имя - ключ кэша: хэш источника (оригинал) или хэш с параметрами
+// варианта после "_".
+func isCacheKey(name string) bool {
+	hash, _, _ := strings.Cut(name, "_")
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil && strings.ToLower(hash) == hash
+}
+
+// isLegacyCacheKey проверяет, что имя - ключ первых версий в виде "<ширина>_<высота>_<хэш>".
+// Хэш в нем считался от другой строки, поэтому перевести такой ключ в текущий формат нельзя.
+func isLegacyCacheKey(name string) bool {
+	parts := strings.Split(name, "_")
+	if len(parts) != 3 || !isDigits(parts[0]) || !isDigits(parts[1]) {
+		return false
+	}
+	return isCacheKey(parts[2])
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// wait дожидается завершения фоновых обновлений или отмены ctx.
+func (rs *resizer) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		rs.background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"                           //nolint:depguard
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp" //nolint:depguard
+	"go.opentelemetry.io/otel"                                      //nolint:depguard
+	"go.opentelemetry.io/otel/propagation"                          //nolint:depguard
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"                   //nolint:depguard
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"                  //nolint:depguard
+	"go.uber.org/zap"
+	"resizer/config"            //nolint:depguard
+	"resizer/internal/cache"    //nolint:depguard
+	"resizer/internal/limiter"  //nolint:depguard
+	"resizer/internal/upstream" //nolint:depguard
+)
+
+// slowOrigin отвечает с задержкой, чтобы одновременные запросы гарантированно пересеклись,
+// и считает обращения к себе.
+func slowOrigin(t *testing.T, status int, delay time.Duration) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	img.Set(1, 1, color.RGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+
+	var hits atomic.Int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		hits.Add(1)
+		time.Sleep(delay)
+		if status != http.StatusOK {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(buf.Bytes())
+	}))
+	t.Cleanup(origin.Close)
+	return origin, &hits
+}
+
+func newTestResizer(t *testing.T) *resizer {
+	t.Helper()
+
+	lruCache, err := cache.NewCache(10, t.TempDir())
+	require.NoError(t, err)
+	return newResizer(lruCache, nil, nil, limiter.New(2, 10, 0), upstream.New(), nil, &config.Config{})
+}
+
+// newOriginalsResizer создает обработчик с хранилищем оригиналов.
+func newOriginalsResizer(t *testing.T) *resizer {
+	t.Helper()
+
+	variants, err := cache.NewCache(10, t.TempDir())
+	require.NoError(t, err)
+	originals, err := cache.NewCache(10, t.TempDir())
+	require.NoError(t, err)
+	return newResizer(variants, originals, nil, limiter.New(2, 10, 0), upstream.New(), nil, &config.Config{})
+}
+
+// getImage выполняет запрос к handler и возвращает ответ.
+func getImage(handler http.Handler, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+// parallelGet выполняет n одновременных запросов и возвращает коды ответов.
+func parallelGet(handler http.Handler, path string, n int) []int {
+	codes := make([]int, n)
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			codes[i] = rec.Code
+		}(i)
+	}
+	wg.Wait()
+	return codes
+}
+
+func TestResizeHandler_coalescesConcurrentRequests(t *testing.T) {
+	origin, hits := slowOrigin(t, http.StatusOK, 200*time.Millisecond)
+	handler := ResizeHandler(newTestResizer(t))
+
+	codes := parallelGet(handler, "/resize/20/10/"+origin.URL+"/image.png", 50)
+	for _, code := range codes {
+		require.Equal(t, http.StatusOK, code)
+	}
+	require.Equal(t, int32(1), hits.Load())
+
+	// Следующий запрос отдается из кэша
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/resize/20/10/"+origin.URL+"/image.png", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+	require.Equal(t, int32(1), hits.Load())
+}
+
+func TestResizeHandler_sharesErrors(t *testing.T) {
+	origin, hits := slowOrigin(t, http.StatusNotFound, 200*time.Millisecond)
+	handler := ResizeHandler(newTestResizer(t))
+
+	codes := parallelGet(handler, "/resize/20/10/"+origin.URL+"/missing.png", 50)
+	for _, code := range codes {
+		require.Equal(t, http.StatusNotFound, code)
+	}
+	require.Equal(t, int32(1), hits.Load())
+}
+
+func TestResizeHandler_rejectsWhenQueueIsFull(t *testing.T) {
+	origin, _ := slowOrigin(t, http.StatusOK, 0)
+
+	lruCache, err := cache.NewCache(10, t.TempDir())
+	require.NoError(t, err)
+	cfg := &config.Config{}
+	cfg.Limits.RetryAfter = 5
+	lim := limiter.New(1, 0, 0)
+	handler := ResizeHandler(newResizer(lruCache, nil, nil, lim, upstream.New(), nil, cfg))
+
+	// Единственное место занято, а очереди нет
+	release, err := lim.Acquire(context.Background(), 1)
+	require.NoError(t, err)
+	defer release()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/resize/20/10/"+origin.URL+"/image.png", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Equal(t, "5", rec.Header().Get("Retry-After"))
+}
+
+func TestResizeHandler_requestDeadline(t *testing.T) {
+	origin, _ := slowOrigin(t, http.StatusOK, 300*time.Millisecond)
+	handler := withDeadline(50*time.Millisecond, ResizeHandler(newTestResizer(t)))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/resize/20/10/"+origin.URL+"/image.png", nil))
+	require.Equal(t, http.StatusGatewayTimeout, rec.Code)
+}
+
+func TestResizeHandler_cancelsFetchWhenClientLeaves(t *testing.T) {
+	aborted := make(chan struct{})
+	origin := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(aborted)
+	}))
+	t.Cleanup(origin.Close)
+	handler := ResizeHandler(newTestResizer(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/resize/20/10/"+origin.URL+"/image.png", nil).WithContext(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Fatal("origin request was not cancelled")
+	}
+}
+
+func TestResizeHandler_tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	traceparent := make(chan string, 1)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent <- r.Header.Get("traceparent")
+		_, _ = w.Write(buf.Bytes())
+	}))
+	t.Cleanup(origin.Close)
+	handler := otelhttp.NewHandler(ResizeHandler(newTestResizer(t)), "resize")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/resize/20/10/"+origin.URL+"/image.png", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	for _, name := range []string{
+		"resize", "cache.lookup", "upstream.fetch", "image.decode", "image.resize", "image.encode", "cache.set",
+	} {
+		require.Contains(t, spans, name)
+	}
+
+	// Все стадии в одной трассе, и источник получил ее контекст
+	traceID := spans["resize"].SpanContext().TraceID()
+	for name, span := range spans {
+		require.Equal(t, traceID, span.SpanContext().TraceID(), name)
+	}
+	require.Contains(t, <-traceparent, traceID.String())
+}
+
+func TestPresetHandler(t *testing.T) {
+	origin, hits := slowOrigin(t, http.StatusOK, 0)
+	rs := newTestResizer(t)
+	cfg := config.Default()
+	cfg.Presets = map[string]config.PresetConfig{
+		"thumb": {Width: 10, Height: 10, Mode: "fill", Format: "jpeg", Quality: 80},
+	}
+	cfg.Limits.PresetsOnly = true
+	rs.setPolicy(newPolicy(cfg))
+
+	get := func(handler http.Handler, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	// Исходное изображение 40x20 обрезается до квадрата и перекодируется в JPEG
+	rec := get(PresetHandler(rs), "/preset/thumb/"+origin.URL+"/image.png")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "image/jpeg", rec.Header().Get("Content-Type"))
+	img, format, err := image.Decode(rec.Body)
+	require.NoError(t, err)
+	require.Equal(t, "jpeg", format)
+	require.Equal(t, image.Rect(0, 0, 10, 10), img.Bounds())
+
+	// Повторный запрос отдается из кэша
+	rec = get(PresetHandler(rs), "/preset/thumb/"+origin.URL+"/image.png")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, int32(1), hits.Load())
+
+	require.Equal(t, http.StatusNotFound, get(PresetHandler(rs), "/preset/hero/"+origin.URL+"/image.png").Code)
+	require.Equal(t, http.StatusBadRequest, get(PresetHandler(rs), "/preset/thumb").Code)
+
+	// Произвольные размеры запрещены
+	require.Equal(t, http.StatusForbidden, get(ResizeHandler(rs), "/resize/20/10/"+origin.URL+"/image.png").Code)
+}
+
+// newTestServer возвращает обработчик основного сервера со всеми обработчиками и ServeMux.
+func newTestServer(t *testing.T) http.Handler {
+	t.Helper()
+
+	cfg := config.Default()
+	dir := t.TempDir()
+	cfg.Storage.CacheDir = filepath.Join(dir, "variants")
+	cfg.Storage.OriginalsCacheDir = filepath.Join(dir, "originals")
+	cfg.Admin.Port = 0
+	srv, err := newServer(cfg, zap.NewNop(), zap.NewAtomicLevel())
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, srv.flush()) })
+	return srv.listeners[0].http.Handler
+}
+
+func TestResizeHandler_dimensions(t *testing.T) {
+	origin, _ := slowOrigin(t, http.StatusOK, 0)
+	// Запросы идут через настоящий HTTP-сервер со всеми обработчиками: пропущенный размер ("//" в адресе)
+	// не должен теряться при маршрутизации
+	srv := httptest.NewServer(newTestServer(t))
+	t.Cleanup(srv.Close)
+
+	get := func(width, height string) (int, []byte) {
+		resp, err := http.Get(srv.URL + "/resize/" + width + "/" + height + "/" + origin.URL + "/image.png")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, body
+	}
+
+	// Источник 40x20: недостающий размер вычисляется по пропорциям, без размеров остается исходный
+	for size, want := range map[[2]string]image.Rectangle{
+		{"20", "0"}: image.Rect(0, 0, 20, 10),
+		{"0", "5"}:  image.Rect(0, 0, 10, 5),
+		{"20", ""}:  image.Rect(0, 0, 20, 10),
+		{"", "5"}:   image.Rect(0, 0, 10, 5),
+		{"", ""}:    image.Rect(0, 0, 40, 20),
+		{"0", "0"}:  image.Rect(0, 0, 40, 20),
+		{"30", "5"}: image.Rect(0, 0, 30, 5),
+	} {
+		code, body := get(size[0], size[1])
+		require.Equal(t, http.StatusOK, code, size)
+		img, _, err := image.Decode(bytes.NewReader(body))
+		require.NoError(t, err)
+		require.Equal(t, want, img.Bounds(), size)
+	}
+
+	for _, size := range [][2]string{{"abc", "10"}, {"10", "1O"}, {"-5", "10"}, {"10.5", "10"}, {"0x10", "10"}} {
+		code, _ := get(size[0], size[1])
+		require.Equal(t, http.StatusBadRequest, code, size)
+	}
+
+	// Размеры больше limits.maxDimension, в том числе вычисленные по пропорциям, отклоняются
+	for _, size := range [][2]string{{"100000", "100000"}, {"10", "10001"}, {"0", "6000"}} {
+		code, body := get(size[0], size[1])
+		require.Equal(t, http.StatusBadRequest, code, size)
+		require.Equal(t, "Image size is too large\n", string(body), size)
+	}
+}
+
+func TestIsCacheKey(t *testing.T) {
+	hash := GenerateHash("http://example.com/image.png")
+	require.True(t, isCacheKey(hash))
+	require.True(t, isCacheKey(newVariant("http://example.com/image.png", 100, 0).cacheKey))
+	require.False(t, isCacheKey("notes.txt"))
+	require.False(t, isCacheKey(strings.ToUpper(hash)))
+	require.False(t, isCacheKey(hash[:10]+"_100_0"))
+}
+
+func TestIsLegacyCacheKey(t *testing.T) {
+	hash := GenerateHash("http://example.com/image.png")
+	require.True(t, isLegacyCacheKey("300_200_"+hash))
+	require.False(t, isLegacyCacheKey(newVariant("http://example.com/image.png", 300, 200).cacheKey))
+	require.False(t, isLegacyCacheKey("300_200_"+hash[:10]))
+	require.False(t, isLegacyCacheKey("300__"+hash))
+	require.False(t, isLegacyCacheKey("notes.txt"))
+}
+
+func TestResizeHandler_originals(t *testing.T) {
+	origin, hits := slowOrigin(t, http.StatusOK, 0)
+	rs := newOriginalsResizer(t)
+	handler := ResizeHandler(rs)
+	sourceURL := origin.URL + "/image.png"
+
+	require.Equal(t, http.StatusOK, getImage(handler, "/resize/20/10/"+sourceURL).Code)
+	require.Equal(t, int32(1), hits.Load())
+
+	// Новый размер известного изображения рендерится из сохраненного оригинала
+	rec := getImage(handler, "/resize/30/15/"+sourceURL)
+	require.Equal(t, http.StatusOK, rec.Code)
+	img, _, err := image.Decode(rec.Body)
+	require.NoError(t, err)
+	require.Equal(t, image.Rect(0, 0, 30, 15), img.Bounds())
+	require.Equal(t, int32(1), hits.Load())
+
+	// После удаления по адресу источника оригинал загружается заново
+	purge := httptest.NewRecorder()
+	PurgeHandler(rs).ServeHTTP(purge, httptest.NewRequest(http.MethodPost, "/admin/purge?url="+sourceURL, nil))
+	require.Equal(t, http.StatusOK, purge.Code)
+	_, ok := rs.originals.Get(GenerateHash(sourceURL))
+	require.False(t, ok)
+
+	require.Equal(t, http.StatusOK, getImage(handler, "/resize/40/20/"+sourceURL).Code)
+	require.Equal(t, int32(2), hits.Load())
+}
+
+func TestResizeHandler_staleWhileRevalidate(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+
+	// Ответ источника устаревает сразу; обновление в фоне ждет, пока тест его не отпустит
+	var hits atomic.Int32
+	release := make(chan struct{})
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if hits.Add(1) > 1 {
+			<-release
+		}
+		w.Header().Set("Cache-Control", "max-age=0")
+		_, _ = w.Write(buf.Bytes())
+	}))
+	t.Cleanup(origin.Close)
+
+	variants, err := cache.NewCache(10, t.TempDir(), cache.WithStaleWindow(time.Hour))
+	require.NoError(t, err)
+	rs := newResizer(variants, nil, nil, limiter.New(2, 10, 0), upstream.New(), nil, &config.Config{})
+	handler := ResizeHandler(rs)
+	path := "/resize/20/10/" + origin.URL + "/image.png"
+
+	require.Equal(t, http.StatusOK, getImage(handler, path).Code)
+	require.Equal(t, int32(1), hits.Load())
+
+	// Устаревший вариант отдается сразу, пока обновление еще не закончилось
+	for _, code := range parallelGet(handler, path, 5) {
+		require.Equal(t, http.StatusOK, code)
+	}
+	require.Eventually(t, func() bool { return hits.Load() == 2 }, time.Second, time.Millisecond)
+
+	close(release)
+	require.NoError(t, rs.wait(context.Background()))
+	require.Equal(t, int32(2), hits.Load())
+}
+
+func TestResizeHandler_negativeCache(t *testing.T) {
+	origin, hits := slowOrigin(t, http.StatusNotFound, 0)
+	variants, err := cache.NewCache(10, t.TempDir())
+	require.NoError(t, err)
+	const ttl = 200 * time.Millisecond
+	negative := cache.NewNegativeCache(ttl, 10)
+	rs := newResizer(variants, nil, negative, limiter.New(2, 10, 0), upstream.New(), nil, &config.Config{})
+	handler := ResizeHandler(rs)
+	path := "/resize/20/10/" + origin.URL + "/missing.png"
+
+	// Повторный запрос получает запомненную ошибку без обращения к источнику
+	require.Equal(t, http.StatusNotFound, getImage(handler, path).Code)
+	require.Equal(t, http.StatusNotFound, getImage(handler, path).Code)
+	require.Equal(t, int32(1), hits.Load())
+
+	// После ttl источник запрашивается снова
+	time.Sleep(ttl)
+	require.Equal(t, http.StatusNotFound, getImage(handler, path).Code)
+	require.Equal(t, int32(2), hits.Load())
+}
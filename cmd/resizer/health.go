@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"resizer/internal/limiter" //nolint:depguard
+)
+
+const (
+	statusOK   = "ok"
+	statusFail = "fail"
+)
+
+// healthResponse - тело ответов /healthz и /readyz.
+type healthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks,omitempty"`
+}
+
+// checkResult - результат одной проверки готовности.
+type checkResult struct {
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Details any    `json:"details,omitempty"`
+}
+
+type diskDetails struct {
+	FreeBytes    uint64 `json:"freeBytes"`
+	MinFreeBytes uint64 `json:"minFreeBytes"`
+}
+
+type workersDetails struct {
+	Running int `json:"running"`
+	Queued  int `json:"queued"`
+}
+
+// readiness проверяет, может ли сервер сейчас обслуживать запросы.
+type readiness struct {
+	dirs         []string // директории кэшей, в которые сервер пишет
+	minFreeBytes uint64
+	limiter      *limiter.Limiter
+	draining     atomic.Bool
+}
+
+// drain переводит сервер в неготовое состояние на время остановки,
+// чтобы балансировщик перестал направлять на него новые запросы.
+func (rd *readiness) drain() {
+	rd.draining.Store(true)
+}
+
+// check выполняет все проверки и возвращает их результаты.
+func (rd *readiness) check() healthResponse {
+	resp := healthResponse{Status: statusOK, Checks: make(map[string]checkResult, len(rd.dirs)+2)}
+	for _, dir := range rd.dirs {
+		resp.Checks["storage:"+dir] = rd.checkDir(dir)
+	}
+	resp.Checks["workers"] = rd.checkWorkers()
+	resp.Checks["shutdown"] = rd.checkShutdown()
+
+	for _, c := range resp.Checks {
+		if c.Status != statusOK {
+			resp.Status = statusFail
+		}
+	}
+	return resp
+}
+
+// checkDir проверяет, что в директорию можно писать и на ее разделе достаточно места.
+func (rd *readiness) checkDir(dir string) checkResult {
+	if err := checkWritable(dir); err != nil {
+		return checkResult{Status: statusFail, Error: err.Error()}
+	}
+	free, err := freeDiskSpace(dir)
+	if err != nil {
+		return checkResult{Status: statusFail, Error: fmt.Sprintf("failed to get free disk space: %v", err)}
+	}
+	result := checkResult{Status: statusOK, Details: diskDetails{FreeBytes: free, MinFreeBytes: rd.minFreeBytes}}
+	if free < rd.minFreeBytes {
+		result.Status = statusFail
+		result.Error = "not enough free disk space"
+	}
+	return result
+}
+
+// checkWorkers проверяет, что очередь ресайза не заполнена и новые запросы не будут отклонены.
+func (rd *readiness) checkWorkers() checkResult {
+	stats := rd.limiter.Stats()
+	result := checkResult{Status: statusOK, Details: workersDetails{Running: stats.Running, Queued: stats.Queued}}
+	if rd.limiter.Saturated() {
+		result.Status = statusFail
+		result.Error = "resize queue is full"
+	}
+	return result
+}
+
+func (rd *readiness) checkShutdown() checkResult {
+	if rd.draining.Load() {
+		return checkResult{Status: statusFail, Error: "server is shutting down"}
+	}
+	return checkResult{Status: statusOK}
+}
+
+// checkWritable создает и удаляет в dir временный файл. Файл называется так же, как временные
+// файлы кэша, поэтому, если удалить его не удастся, кэш уберет его при следующем запуске.
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("cache directory is not available: %w", err)
+	}
+	f, err := os.CreateTemp(dir, ".tmp-health-*")
+	if err != nil {
+		return fmt.Errorf("cache directory is not writable: %w", err)
+	}
+	_ = f.Close()
+	return os.Remove(f.Name())
+}
+
+// LivenessHandler сообщает, что процесс жив и обрабатывает запросы.
+func LivenessHandler(logg *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		writeHealth(w, http.StatusOK, healthResponse{Status: statusOK}, logg)
+	}
+}
+
+// ReadinessHandler сообщает, готов ли сервер принимать запросы: кэши доступны для записи,
+// места на диске достаточно, очередь ресайза не заполнена и сервер не останавливается.
+// Если хотя бы одна проверка не прошла, отвечает 503 с результатами всех проверок.
+func ReadinessHandler(rd *readiness, logg *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		resp := rd.check()
+		status := http.StatusOK
+		if resp.Status != statusOK {
+			status = http.StatusServiceUnavailable
+		}
+		writeHealth(w, status, resp, logg)
+	}
+}
+
+func writeHealth(w http.ResponseWriter, status int, resp healthResponse, logg *zap.Logger) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logg.Error(fmt.Sprintf("Failed to write response: %v", err))
+	}
+}
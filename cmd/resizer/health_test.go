@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require" //nolint:depguard
+	"go.uber.org/zap"
+	"resizer/internal/limiter" //nolint:depguard
+)
+
+func getReadiness(t *testing.T, rd *readiness) (int, healthResponse) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	ReadinessHandler(rd, zap.NewNop()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var resp healthResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return rec.Code, resp
+}
+
+func TestLivenessHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	LivenessHandler(zap.NewNop()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"status":"ok"}`, rec.Body.String())
+}
+
+func TestReadinessHandler(t *testing.T) {
+	dir := t.TempDir()
+	lim := limiter.New(1, 1, 0)
+	rd := &readiness{dirs: []string{dir}, limiter: lim}
+
+	code, resp := getReadiness(t, rd)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, statusOK, resp.Status)
+	require.Equal(t, statusOK, resp.Checks["storage:"+dir].Status)
+	require.Equal(t, statusOK, resp.Checks["workers"].Status)
+	require.Equal(t, statusOK, resp.Checks["shutdown"].Status)
+
+	t.Run("saturated", func(t *testing.T) {
+		release, err := lim.Acquire(context.Background(), 1)
+		require.NoError(t, err)
+		queued := make(chan struct{})
+		go func() {
+			defer close(queued)
+			if release, err := lim.Acquire(context.Background(), 1); err == nil {
+				release()
+			}
+		}()
+		require.Eventually(t, lim.Saturated, time.Second, 10*time.Millisecond)
+
+		code, resp := getReadiness(t, rd)
+		require.Equal(t, http.StatusServiceUnavailable, code)
+		require.Equal(t, statusFail, resp.Checks["workers"].Status)
+		require.Equal(t, statusOK, resp.Checks["storage:"+dir].Status)
+
+		release()
+		<-queued
+	})
+
+	t.Run("not enough disk space", func(t *testing.T) {
+		rd := &readiness{dirs: []string{dir}, minFreeBytes: math.MaxUint64, limiter: lim}
+
+		code, resp := getReadiness(t, rd)
+		require.Equal(t, http.StatusServiceUnavailable, code)
+		require.Equal(t, statusFail, resp.Checks["storage:"+dir].Status)
+	})
+
+	t.Run("draining", func(t *testing.T) {
+		rd.drain()
+
+		code, resp := getReadiness(t, rd)
+		require.Equal(t, http.StatusServiceUnavailable, code)
+		require.Equal(t, statusFail, resp.Status)
+		require.Equal(t, statusFail, resp.Checks["shutdown"].Status)
+	})
+}
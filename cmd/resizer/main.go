@@ -1,77 +1,123 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
-	"strconv"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/joho/godotenv" //nolint:depguard
 	"github.com/spf13/cobra"   //nolint:depguard
 	"go.uber.org/zap"
-	"resizer/config"         //nolint:depguard
-	"resizer/internal/cache" //nolint:depguard
-	"resizer/logger"         //nolint:depguard
+	"resizer/config" //nolint:depguard
+	"resizer/logger" //nolint:depguard
 )
 
 func main() {
 	var versionFlag bool
-	configFile := "./config/config.yaml"
-	cfg, err := config.LoadConfig(configFile)
-	if err != nil {
-		log.Fatalf("failed to load config: %v", err)
-	}
 
-	// Загрузка переменных окружения из файла .env
+	// Загрузка переменных окружения из файла .env, в том числе настроек RESIZER_*
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found, using environment variables or defaults")
 	}
 
-	// Определение режима работы (по умолчанию production)
-	isDevelopment := strings.ToLower(os.Getenv("ENV_APP")) == "dev"
-
-	logg, err := logger.NewLogger(cfg.Logger.Level, isDevelopment)
-	if err != nil {
-		log.Fatalf("failed to initialize logger: %v", err)
-	}
-	defer func(logg *zap.Logger) {
-		_ = logg.Sync()
-	}(logg)
+	// Конфигурация загружается после разбора флагов, которые ее переопределяют
+	cfg := &config.Config{}
+	logg := zap.NewNop()
+	level := zap.NewAtomicLevel()
 
 	rootCmd := &cobra.Command{
-		Use:   "resizer",
-		Short: "Image resize service",
-		Run: func(_ *cobra.Command, _ []string) {
+		Use:           "resizer",
+		Short:         "Image resize service",
+		SilenceErrors: true,
+		SilenceUsage:  true, // ошибки конфигурации не сопровождаются справкой
+		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
 			if versionFlag {
-				printVersion()
-				return
+				return nil
+			}
+			loaded, err := config.Load(cmd.Flags())
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
 			}
+			*cfg = *loaded
 
-			logg.Info("Storage is running...")
-			// Инициализация LRU-кэша
-			lruCache, err := cache.NewCache(cfg.Storage.CacheSize, cfg.Storage.CacheDir)
+			logg, err = newLogger(cfg, level)
 			if err != nil {
-				logg.Error(fmt.Sprintf("Failed to initialize cache: %v", err))
-				return
+				return fmt.Errorf("failed to initialize logger: %w", err)
+			}
+			// Общий логгер пишет то, что происходит вне запросов с собственным логгером
+			zap.ReplaceGlobals(logg)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if versionFlag {
+				printVersion()
+				return nil
 			}
 
-			// Регистрация обработчиков
-			http.HandleFunc("/resize/", ResizeHandler(lruCache, logg))
+			logg.Info("Storage is running...", zap.String("config", cfg.File))
+			// SIGINT и SIGTERM запускают плавную остановку
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			// SIGHUP перечитывает конфигурацию; перехватываем его сразу, чтобы он не остановил запуск
+			hup := make(chan os.Signal, 1)
+			signal.Notify(hup, syscall.SIGHUP)
+			defer signal.Stop(hup)
 
-			logg.Info(fmt.Sprintf("Starting server on : %s...", strconv.Itoa(cfg.Server.Port)))
-			err = http.ListenAndServe(fmt.Sprintf(":%s", strconv.Itoa(cfg.Server.Port)), nil)
+			// Ошибки запуска и работы сервера возвращаются, чтобы процесс завершился с ненулевым кодом
+			srv, err := newServer(cfg, logg, level)
 			if err != nil {
-				return
+				return err
+			}
+			load := func() (*config.Config, error) { return config.Load(cmd.Flags()) }
+			reloader := newConfigReloader(cfg, load, srv.applyConfig, logg)
+			watchConfig(ctx, reloader, hup, cfg.File, seconds(cfg.Reload.WatchInterval))
+			if err := srv.run(ctx); err != nil {
+				return fmt.Errorf("server stopped with error: %w", err)
 			}
+			return nil
 		},
 	}
 
 	// Флаг --version
 	rootCmd.Flags().BoolVar(&versionFlag, "version", false, "print the version of the application")
+	// Флаг --config и флаги для всех настроек доступны во всех командах
+	config.BindFlags(rootCmd.PersistentFlags())
+
+	rootCmd.AddCommand(newCacheCommand(cfg))
+	rootCmd.AddCommand(newConfigCommand(cfg))
+
+	err := rootCmd.Execute()
+	_ = logg.Sync()
+	if err != nil {
+		log.Fatalf("command execution failed: %v", err)
+	}
+}
+
+// newLogger создает логгер по настройкам logger и выставляет уровень level.
+func newLogger(cfg *config.Config, level zap.AtomicLevel) (*zap.Logger, error) {
+	// Уровень логирования можно менять без перезапуска: через /admin/log-level или SIGHUP
+	logLevel, err := logger.ParseLevel(cfg.Logger.Level)
+	if err != nil {
+		return nil, err
+	}
+	level.SetLevel(logLevel)
+
+	// Определение режима работы (по умолчанию production)
+	isDevelopment := strings.ToLower(os.Getenv("ENV_APP")) == "dev"
 
-	if err := rootCmd.Execute(); err != nil {
-		logg.Fatal(fmt.Sprintf("command execution failed: %v", err))
+	opts := []logger.Option{logger.WithSampling(cfg.Logger.Sampling.Initial, cfg.Logger.Sampling.Thereafter)}
+	if cfg.Logger.File.Path != "" {
+		opts = append(opts, logger.WithFile(
+			cfg.Logger.File.Path,
+			cfg.Logger.File.MaxSize,
+			cfg.Logger.File.MaxBackups,
+			cfg.Logger.File.MaxAge,
+			cfg.Logger.File.Compress,
+		))
 	}
+	return logger.NewLogger(level, isDevelopment, opts...), nil
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"resizer/config" //nolint:depguard
+)
+
+// reloadable перечисляет настройки, которые применяются без перезапуска (см. server.applyConfig).
+// Путь с точкой на конце охватывает всю секцию.
+var reloadable = []string{
+	"logger.level",
+	"limits.",
+	"presets",
+	"dpr.",
+	"storage.defaultTTL",
+	"storage.defaultImageQuality",
+}
+
+func isReloadable(path string) bool {
+	for _, p := range reloadable {
+		if path == p || strings.HasSuffix(p, ".") && strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// configReloader заново загружает конфигурацию и применяет настройки, которые меняются без перезапуска.
+type configReloader struct {
+	load    func() (*config.Config, error)
+	apply   func(*config.Config) error
+	started *config.Config // конфигурация, с которой запущен сервер
+	applied *config.Config // последняя примененная конфигурация
+	logg    *zap.Logger
+}
+
+func newConfigReloader(
+	cfg *config.Config,
+	load func() (*config.Config, error),
+	apply func(*config.Config) error,
+	logg *zap.Logger,
+) *configReloader {
+	return &configReloader{load: load, apply: apply, started: cfg, applied: cfg, logg: logg}
+}
+
+// reload загружает и проверяет конфигурацию. Если в ней есть ошибки, продолжает действовать прежняя.
+// Измененные настройки, которые требуют перезапуска, пишутся в журнал, пока сервер не перезапущен.
+func (r *configReloader) reload() {
+	cfg, err := r.load()
+	if err != nil {
+		r.logg.Error("Failed to reload config, keeping the current one", zap.Error(err))
+		return
+	}
+	if err := r.apply(cfg); err != nil {
+		r.logg.Error("Failed to apply reloaded config", zap.Error(err))
+		return
+	}
+
+	var changed, restart []string
+	for _, path := range r.applied.Diff(cfg) {
+		if isReloadable(path) {
+			changed = append(changed, path)
+		}
+	}
+	for _, path := range r.started.Diff(cfg) {
+		if !isReloadable(path) {
+			restart = append(restart, path)
+		}
+	}
+	r.applied = cfg
+
+	if len(changed) > 0 {
+		r.logg.Warn("Config reloaded", zap.Strings("changed", changed))
+	}
+	if len(restart) > 0 {
+		r.logg.Warn("Config changes require restart", zap.Strings("fields", restart))
+	}
+}
+
+// watchConfig перезагружает конфигурацию по сигналу из hup и при изменении файла file, который
+// проверяется каждые interval (0 - не проверяется). Работает в фоне до отмены ctx.
+func watchConfig(ctx context.Context, r *configReloader, hup <-chan os.Signal, file string, interval time.Duration) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		tick = ticker.C
+		context.AfterFunc(ctx, ticker.Stop)
+	}
+
+	go func() {
+		last := statFile(file)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+			case <-tick:
+				if statFile(file) == last {
+					continue
+				}
+			}
+			last = statFile(file)
+			r.reload()
+		}
+	}()
+}
+
+// fileVersion отличает измененный файл от прежнего. Редакторы часто заменяют файл новым,
+// поэтому сравниваются время изменения и размер, а не содержимое открытого файла.
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// statFile возвращает версию файла; для недоступного файла - нулевую.
+func statFile(path string) fileVersion {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileVersion{}
+	}
+	return fileVersion{modTime: info.ModTime(), size: info.Size()}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require" //nolint:depguard
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"resizer/config" //nolint:depguard
+)
+
+func TestConfigReloader(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	started := config.Default()
+
+	next := config.Default()
+	var loadErr error
+	var applied *config.Config
+	r := newConfigReloader(started, func() (*config.Config, error) {
+		cp := *next
+		return &cp, loadErr
+	}, func(cfg *config.Config) error {
+		applied = cfg
+		return nil
+	}, zap.New(core))
+
+	// Настройки, которые меняются без перезапуска, применяются
+	next.Logger.Level = "debug"
+	next.Limits.MaxQueue = 10
+	r.reload()
+	require.Equal(t, "debug", applied.Logger.Level)
+	entries := logs.TakeAll()
+	require.Len(t, entries, 1)
+	require.Equal(t, "Config reloaded", entries[0].Message)
+	require.Equal(t, []any{"logger.level", "limits.maxQueue"}, entries[0].ContextMap()["changed"])
+
+	// Об остальных сообщается, пока сервер не перезапущен
+	next.Server.Port = 8081
+	r.reload()
+	r.reload()
+	entries = logs.TakeAll()
+	require.Len(t, entries, 2)
+	for _, e := range entries {
+		require.Equal(t, "Config changes require restart", e.Message)
+		require.Equal(t, []any{"server.port"}, e.ContextMap()["fields"])
+	}
+
+	// Ошибочная конфигурация не применяется
+	applied = nil
+	loadErr = errors.New("invalid config")
+	r.reload()
+	require.Nil(t, applied)
+	require.Equal(t, "Failed to reload config, keeping the current one", logs.TakeAll()[0].Message)
+}
+
+func TestWatchConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("a"), 0o600))
+
+	reloads := make(chan struct{}, 10)
+	r := newConfigReloader(config.Default(), func() (*config.Config, error) {
+		reloads <- struct{}{}
+		return config.Default(), nil
+	}, func(*config.Config) error { return nil }, zap.NewNop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hup := make(chan os.Signal, 1)
+	watchConfig(ctx, r, hup, file, 10*time.Millisecond)
+
+	// Без изменений файл не перечитывается
+	time.Sleep(50 * time.Millisecond)
+	require.Empty(t, reloads)
+
+	require.NoError(t, os.WriteFile(file, []byte("ab"), 0o600))
+	require.Eventually(t, func() bool { return len(reloads) == 1 }, time.Second, time.Millisecond)
+
+	hup <- syscall.SIGHUP
+	require.Eventually(t, func() bool { return len(reloads) == 2 }, time.Second, time.Millisecond)
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp" //nolint:depguard
+	"go.uber.org/zap"
+	"resizer/config"            //nolint:depguard
+	"resizer/internal/cache"    //nolint:depguard
+	"resizer/internal/limiter"  //nolint:depguard
+	"resizer/internal/metrics"  //nolint:depguard
+	"resizer/internal/tracing"  //nolint:depguard
+	"resizer/internal/upstream" //nolint:depguard
+	"resizer/logger"            //nolint:depguard
+)
+
+const (
+	// negativeCacheEntries - сколько ошибок источников хранится одновременно.
+	negativeCacheEntries = 10_000
+	// defaultShutdownTimeout используется, если время на остановку не задано в конфигурации.
+	defaultShutdownTimeout = 30 * time.Second
+)
+
+var (
+	// cacheKeys не дает кэшам принимать за свои записи чужие файлы в корне директории кэша.
+	cacheKeys = cache.WithKeyFormat(isCacheKey)
+	// legacyKeys удаляет записи первых версий, ключи которых нельзя перевести в текущий формат.
+	legacyKeys = cache.WithLegacyKeyFormat(isLegacyCacheKey)
+)
+
+// server объединяет HTTP-серверы и хранилища, которые нужно корректно закрыть при остановке.
+type server struct {
+	listeners       []listener // основной и, если включен, административный
+	resizer         *resizer
+	limiter         *limiter.Limiter
+	level           zap.AtomicLevel
+	fetcher         *upstream.Fetcher
+	tracing         *tracing.Provider
+	caches          []cache.Cache // сбрасываются на диск после остановки
+	readiness       *readiness
+	drainDelay      time.Duration
+	shutdownTimeout time.Duration
+	logg            *zap.Logger
+}
+
+// newServer создает кэши, ограничитель и регистрирует обработчики.
+func newServer(cfg *config.Config, logg *zap.Logger, level zap.AtomicLevel) (*server, error) {
+	// Инициализация дискового кэша с выбранной политикой вытеснения
+	policy, err := cache.NewPolicy(cfg.Storage.EvictionPolicy, cfg.Storage.CacheSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize cache: %w", err)
+	}
+	staleWindow := cache.WithStaleWindow(time.Duration(cfg.Storage.StaleWhileRevalidate) * time.Second)
+	// Срок годности записей, которые не успели попасть в индекс до аварийной остановки
+	defaultTTL := cache.WithDefaultTTL(seconds(cfg.Storage.DefaultTTL))
+	lruCache, err := cache.NewCache(
+		cfg.Storage.CacheSize, cfg.Storage.CacheDir, staleWindow, defaultTTL, cacheKeys, legacyKeys,
+		cache.WithPolicy(policy),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize cache: %w", err)
+	}
+	// Горячий уровень в памяти поверх дискового кэша
+	if cfg.Storage.MemoryCacheSize > 0 {
+		lruCache = cache.NewTieredCache(int64(cfg.Storage.MemoryCacheSize)<<20, lruCache, staleWindow)
+	}
+	caches := []cache.Cache{lruCache}
+	cacheDirs := []string{cfg.Storage.CacheDir}
+
+	// Хранилище оригиналов со своим лимитом
+	var originals cache.Cache
+	if cfg.Storage.OriginalsCacheSize > 0 {
+		originals, err = cache.NewCache(
+			cfg.Storage.OriginalsCacheSize, cfg.Storage.OriginalsCacheDir, staleWindow, defaultTTL, cacheKeys, legacyKeys,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize originals cache: %w", err)
+		}
+		caches = append(caches, originals)
+		cacheDirs = append(cacheDirs, cfg.Storage.OriginalsCacheDir)
+	}
+
+	// Кэш ошибок источника
+	var negative *cache.NegativeCache
+	if cfg.Storage.NegativeTTL > 0 {
+		negative = cache.NewNegativeCache(time.Duration(cfg.Storage.NegativeTTL)*time.Second, negativeCacheEntries)
+	}
+
+	// Ограничение одновременной обработки изображений
+	lim := limiter.New(limits(cfg))
+
+	m := metrics.New(metrics.WithHosts(cfg.Admin.MetricsHosts...))
+	m.RegisterCache(variantsCache, lruCache)
+	if originals != nil {
+		m.RegisterCache(originalsCache, originals)
+	}
+	m.RegisterLimiter(lim)
+
+	// Общий пул соединений с источниками
+	fetcher, err := newFetcher(cfg, m, logg)
+	if err != nil {
+		return nil, err
+	}
+	m.RegisterBreakers(fetcher)
+
+	tp, err := newTracing(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	rs := newResizer(lruCache, originals, negative, lim, fetcher, m, cfg)
+	rd := &readiness{
+		dirs:         cacheDirs,
+		minFreeBytes: uint64(cfg.Health.MinFreeDiskSpace) << 20,
+		limiter:      lim,
+	}
+
+	// Регистрация обработчиков
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", LivenessHandler(logg))
+	mux.Handle("/readyz", ReadinessHandler(rd, logg))
+	mux.Handle("/preset/", otelhttp.NewHandler(m.Instrument("preset", PresetHandler(rs)), "preset"))
+	resize := otelhttp.NewHandler(m.Instrument("resize", ResizeHandler(rs)), "resize")
+	handler := withRawPath("/resize/", resize, mux)
+
+	shutdownTimeout := seconds(cfg.Server.ShutdownTimeout)
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = defaultShutdownTimeout
+	}
+
+	listeners := []listener{{name: "server", http: &http.Server{
+		Addr:              net.JoinHostPort(cfg.Server.Host, strconv.Itoa(cfg.Server.Port)),
+		Handler:           withAccessLog(logg, withDeadline(seconds(cfg.Server.RequestTimeout), handler)),
+		ReadHeaderTimeout: seconds(cfg.Server.ReadHeaderTimeout),
+		ReadTimeout:       seconds(cfg.Server.ReadTimeout),
+		WriteTimeout:      seconds(cfg.Server.WriteTimeout),
+		IdleTimeout:       seconds(cfg.Server.IdleTimeout),
+	}}}
+
+	// Метрики и служебные обработчики отдаются отдельным сервером, который не виден клиентам
+	if cfg.Admin.Port != 0 {
+		adminMux := http.NewServeMux()
+		adminMux.Handle("/metrics", m.Handler())
+		if cfg.Admin.Token != "" {
+			adminMux.Handle("/admin/purge", requireToken(cfg.Admin.Token, PurgeHandler(rs)))
+			adminMux.Handle("/admin/log-level", requireToken(cfg.Admin.Token, LogLevelHandler(level)))
+		} else {
+			logg.Info("Admin token is not configured, admin endpoints are disabled")
+		}
+		listeners = append(listeners, listener{name: "admin server", http: &http.Server{
+			Addr:              net.JoinHostPort(cfg.Admin.Host, strconv.Itoa(cfg.Admin.Port)),
+			Handler:           adminMux,
+			ReadHeaderTimeout: seconds(cfg.Server.ReadHeaderTimeout),
+		}})
+	} else {
+		logg.Info("Admin port is not configured, metrics and admin endpoints are disabled")
+	}
+
+	return &server{
+		listeners:       listeners,
+		resizer:         rs,
+		limiter:         lim,
+		level:           level,
+		fetcher:         fetcher,
+		tracing:         tp,
+		caches:          caches,
+		readiness:       rd,
+		drainDelay:      seconds(cfg.Server.DrainDelay),
+		shutdownTimeout: shutdownTimeout,
+		logg:            logg,
+	}, nil
+}
+
+// run обслуживает запросы до отмены ctx, после чего перестает принимать новые соединения,
+// дожидается текущих запросов и фоновых обновлений и сбрасывает кэши на диск.
+func (s *server) run(ctx context.Context) error {
+	errCh := make(chan error, len(s.listeners))
+	for _, l := range s.listeners {
+		go func(l listener) {
+			s.logg.Info(fmt.Sprintf("Starting %s on %s...", l.name, l.http.Addr))
+			errCh <- l.http.ListenAndServe()
+		}(l)
+	}
+
+	var errs []error
+	running := len(s.listeners)
+	select {
+	case err := <-errCh:
+		// Сервер не запустился или упал сам - останавливаем остальные и сохраняем то, что успели закэшировать
+		errs = append(errs, err)
+		running--
+	case <-ctx.Done():
+		// Сначала сообщаем о неготовности и даем балансировщику время убрать сервер из ротации
+		s.readiness.drain()
+		if s.drainDelay > 0 {
+			s.logg.Info(fmt.Sprintf("Readiness check is failing, waiting %s before shutdown...", s.drainDelay))
+			time.Sleep(s.drainDelay)
+		}
+	}
+
+	s.logg.Info(fmt.Sprintf("Shutting down, waiting up to %s for in-flight requests...", s.shutdownTimeout))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+
+	for _, l := range s.listeners {
+		if err := l.http.Shutdown(shutdownCtx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to drain requests: %w", err))
+		}
+	}
+	for ; running > 0; running-- {
+		if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+			errs = append(errs, err)
+		}
+	}
+	if err := s.resizer.wait(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to wait for background revalidations: %w", err))
+	}
+	s.fetcher.Close()
+	errs = append(errs, s.flush())
+	if err := s.tracing.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to export traces: %w", err))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	s.logg.Info("Server stopped")
+	return nil
+}
+
+// applyConfig применяет настройки, которые меняются без перезапуска: уровень логирования,
+// ограничения обработки и политику обработки запросов.
+func (s *server) applyConfig(cfg *config.Config) error {
+	logLevel, err := logger.ParseLevel(cfg.Logger.Level)
+	if err != nil {
+		return err
+	}
+	s.level.SetLevel(logLevel)
+	s.limiter.SetLimits(limits(cfg))
+	s.resizer.setPolicy(newPolicy(cfg))
+	return nil
+}
+
+// limits возвращает ограничения обработки изображений: число одновременных задач
+// (0 - по числу CPU), длину очереди и бюджет пикселей.
+func limits(cfg *config.Config) (maxConcurrency, maxQueue int, maxPixels int64) {
+	maxConcurrency = cfg.Limits.MaxConcurrency
+	if maxConcurrency == 0 {
+		maxConcurrency = runtime.NumCPU()
+	}
+	return maxConcurrency, cfg.Limits.MaxQueue, int64(cfg.Limits.MaxPixels) * 1_000_000
+}
+
+// listener - HTTP-сервер с именем для журнала.
+type listener struct {
+	name string
+	http *http.Server
+}
+
+// newFetcher создает загрузчик исходных изображений по настройкам upstream.
+func newFetcher(cfg *config.Config, m *metrics.Metrics, logg *zap.Logger) (*upstream.Fetcher, error) {
+	// Устаревший storage.readTimeout используется, если upstream.timeout не задан
+	timeout := cfg.Upstream.Timeout
+	if timeout == 0 {
+		timeout = cfg.Storage.ReadTimeout
+	}
+	opts := []upstream.Option{
+		upstream.WithTimeout(seconds(timeout)),
+		upstream.WithDialTimeout(seconds(cfg.Upstream.DialTimeout)),
+		upstream.WithTLSHandshakeTimeout(seconds(cfg.Upstream.TLSHandshakeTimeout)),
+		upstream.WithKeepAlive(seconds(cfg.Upstream.KeepAlive)),
+		upstream.WithMaxIdleConnsPerHost(cfg.Upstream.MaxIdleConnsPerHost),
+		upstream.WithMaxRedirects(cfg.Upstream.MaxRedirects),
+		upstream.WithRetries(
+			cfg.Upstream.Retries,
+			time.Duration(cfg.Upstream.RetryBackoff)*time.Millisecond,
+			time.Duration(cfg.Upstream.RetryMaxBackoff)*time.Millisecond,
+		),
+		upstream.WithCircuitBreaker(
+			cfg.Upstream.BreakerThreshold,
+			seconds(cfg.Upstream.BreakerCooldown),
+			func(host string, from, to upstream.BreakerState) {
+				logg.Warn(fmt.Sprintf("Circuit breaker for origin %s: %s -> %s", host, from, to))
+			},
+		),
+		upstream.WithObserver(m),
+	}
+	if cfg.Upstream.Proxy != "" {
+		proxyURL, err := url.Parse(cfg.Upstream.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upstream proxy: %w", err)
+		}
+		opts = append(opts, upstream.WithProxy(proxyURL))
+	}
+	return upstream.New(opts...), nil
+}
+
+// newTracing настраивает экспорт трасс по настройкам tracing.
+func newTracing(cfg *config.Config) (*tracing.Provider, error) {
+	opts := []tracing.Option{
+		tracing.WithService("resizer", release),
+		tracing.WithEndpoint(cfg.Tracing.Endpoint, cfg.Tracing.Insecure),
+		tracing.WithFile(cfg.Tracing.File),
+	}
+	if cfg.Tracing.SampleRatio > 0 {
+		opts = append(opts, tracing.WithSampleRatio(cfg.Tracing.SampleRatio))
+	}
+	tp, err := tracing.New(cfg.Tracing.Exporter, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize tracing: %w", err)
+	}
+	return tp, nil
+}
+
+// withDeadline ограничивает общее время обработки запроса: по истечении timeout контекст
+// запроса отменяется, и вся работа, которую ждет только этот запрос, прекращается.
+func withDeadline(timeout time.Duration, next http.Handler) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// withRawPath передает запросы с префиксом prefix в handler в обход ServeMux. ServeMux схлопывает "//"
+// в адресе и перенаправляет запрос, из-за чего пропущенный размер в /resize/300//... потерялся бы.
+func withRawPath(prefix string, handler, mux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// seconds переводит значение из конфигурации в time.Duration.
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
+
+// flush сбрасывает кэши на диск.
+func (s *server) flush() error {
+	errs := make([]error, 0, len(s.caches))
+	for _, c := range s.caches {
+		if err := c.Flush(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to flush cache: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
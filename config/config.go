@@ -1,7 +1,10 @@
 package config
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 
 	"gopkg.in/yaml.v3"
@@ -9,27 +12,188 @@ import (
 
 // LoggerConfig представляет настройки логгера.
 type LoggerConfig struct {
-	Level string `yaml:"level"`
+	Level    string `yaml:"level"` // error, warn, info или debug; перечитывается по SIGHUP
+	Sampling struct {
+		Initial    int `yaml:"initial"`    // сколько записей с одинаковым сообщением в секунду пишется целиком
+		Thereafter int `yaml:"thereafter"` // затем пишется каждая N-я из них, 0 отключает сэмплирование
+	} `yaml:"sampling"`
+	File struct {
+		Path       string `yaml:"path"`       // пустой - только stdout
+		MaxSize    int    `yaml:"maxSize"`    // в мегабайтах, после него файл ротируется
+		MaxBackups int    `yaml:"maxBackups"` // сколько ротированных файлов хранить, 0 - все
+		MaxAge     int    `yaml:"maxAge"`     // в днях, 0 - ротированные файлы не удаляются по возрасту
+		Compress   bool   `yaml:"compress"`   // сжимать ротированные файлы gzip
+	} `yaml:"file"`
 }
 
+// ServerConfig представляет настройки HTTP-сервера. Все таймауты задаются в секундах, 0 - без ограничения.
 type ServerConfig struct {
-	Host string `yaml:"host"`
-	Port int    `yaml:"port"`
+	Host              string `yaml:"host"` // пустой - все интерфейсы
+	Port              int    `yaml:"port"`
+	ReadHeaderTimeout int    `yaml:"readHeaderTimeout"`
+	ReadTimeout       int    `yaml:"readTimeout"`
+	WriteTimeout      int    `yaml:"writeTimeout"`
+	IdleTimeout       int    `yaml:"idleTimeout"`
+	RequestTimeout    int    `yaml:"requestTimeout"` // общее время обработки запроса
+	ShutdownTimeout   int    `yaml:"shutdownTimeout"`
+	DrainDelay        int    `yaml:"drainDelay"` // сколько /readyz отвечает ошибкой перед остановкой приема запросов
+}
+
+// UpstreamConfig представляет настройки обращения к источникам изображений.
+type UpstreamConfig struct {
+	Timeout             int    `yaml:"timeout"` // в секундах, на всю загрузку исходного изображения
+	DialTimeout         int    `yaml:"dialTimeout"`
+	TLSHandshakeTimeout int    `yaml:"tlsHandshakeTimeout"`
+	KeepAlive           int    `yaml:"keepAlive"`
+	MaxIdleConnsPerHost int    `yaml:"maxIdleConnsPerHost"`
+	MaxRedirects        int    `yaml:"maxRedirects"` // 0 - перенаправления не выполняются
+	Proxy               string `yaml:"proxy"`        // пустой - HTTP_PROXY/HTTPS_PROXY из окружения
+	Retries             int    `yaml:"retries"`      // дополнительные попытки после временной ошибки
+	RetryBackoff        int    `yaml:"retryBackoff"` // в миллисекундах
+	RetryMaxBackoff     int    `yaml:"retryMaxBackoff"`
+	BreakerThreshold    int    `yaml:"breakerThreshold"` // ошибок подряд, 0 отключает автоматы источников
+	BreakerCooldown     int    `yaml:"breakerCooldown"`  // в секундах
+}
+
+// AdminConfig представляет настройки административного API.
+type AdminConfig struct {
+	Token        string   `yaml:"token" secret:"true"` // пустой токен отключает административные обработчики
+	Host         string   `yaml:"host"`                // адрес служебного сервера, пустой - все интерфейсы
+	Port         int      `yaml:"port"`                // 0 отключает служебный сервер
+	MetricsHosts []string `yaml:"metricsHosts"`        // хосты источников с собственной меткой host в метриках
+}
+
+// HealthConfig представляет настройки проверки готовности.
+type HealthConfig struct {
+	MinFreeDiskSpace int `yaml:"minFreeDiskSpace"` // в мегабайтах, при меньшем свободном месте /readyz отвечает ошибкой
+}
+
+// TracingConfig представляет настройки трассировки OpenTelemetry.
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter"`    // otlp, stdout или file; пустой отключает трассировку
+	Endpoint    string  `yaml:"endpoint"`    // host:port коллектора OTLP/HTTP, пустой - OTEL_EXPORTER_OTLP_ENDPOINT
+	Insecure    bool    `yaml:"insecure"`    // HTTP без TLS до коллектора
+	File        string  `yaml:"file"`        // файл для экспортера file
+	SampleRatio float64 `yaml:"sampleRatio"` // доля трасс, начатых сервисом, 0 - все
+}
+
+// LimitsConfig представляет ограничения на одновременную обработку изображений.
+type LimitsConfig struct {
+	MaxConcurrency int  `yaml:"maxConcurrency"` // 0 - по числу CPU
+	MaxQueue       int  `yaml:"maxQueue"`
+	MaxPixels      int  `yaml:"maxPixels"`    // в мегапикселях, 0 - без ограничения
+	MaxDimension   int  `yaml:"maxDimension"` // наибольшая ширина или высота результата, 0 - без ограничения
+	RetryAfter     int  `yaml:"retryAfter"`   // в секундах
+	PresetsOnly    bool `yaml:"presetsOnly"`  // /resize/ отклоняется, создаются только пресеты
+}
+
+// PresetConfig описывает именованный вариант изображения, который отдается по адресу /preset/{name}/{url}.
+type PresetConfig struct {
+	Width   int    `yaml:"width"`
+	Height  int    `yaml:"height"`
+	Mode    string `yaml:"mode"`    // resize, fit или fill; пустой - resize
+	Gravity string `yaml:"gravity"` // что сохраняет fill: center, north, southeast...; пустой - center
+	Quality int    `yaml:"quality"` // качество JPEG, 0 - storage.defaultImageQuality
+	Format  string `yaml:"format"`  // jpeg, png или gif; пустой - формат источника
+}
+
+// DPRConfig представляет настройки вариантов для экранов с высокой плотностью пикселей.
+type DPRConfig struct {
+	Max         float64 `yaml:"max"`         // наибольший множитель, 1 отключает DPR
+	ClientHints bool    `yaml:"clientHints"` // брать множитель из заголовков Sec-CH-DPR/DPR, если его нет в адресе
+}
+
+// ReloadConfig представляет настройки перезагрузки конфигурации без перезапуска.
+type ReloadConfig struct {
+	WatchInterval int `yaml:"watchInterval"` // в секундах, 0 отключает слежение за файлом; SIGHUP перечитывает всегда
 }
 
 // Config представляет основную структуру конфигурации сервиса.
 type Config struct {
-	Logger  LoggerConfig `yaml:"logger"`
-	Server  ServerConfig `yaml:"server"`
-	Storage struct {
+	File string `yaml:"-"` // путь, из которого загружена конфигурация
+
+	Logger   LoggerConfig            `yaml:"logger"`
+	Server   ServerConfig            `yaml:"server"`
+	Admin    AdminConfig             `yaml:"admin"`
+	Health   HealthConfig            `yaml:"health"`
+	Tracing  TracingConfig           `yaml:"tracing"`
+	Limits   LimitsConfig            `yaml:"limits"`
+	Upstream UpstreamConfig          `yaml:"upstream"`
+	Reload   ReloadConfig            `yaml:"reload"`
+	Presets  map[string]PresetConfig `yaml:"presets"` // только в файле, флагами не переопределяются
+	DPR      DPRConfig               `yaml:"dpr"`
+	Storage  struct {
 		CacheSize            int    `yaml:"cacheSize"`
 		CacheDir             string `yaml:"cacheDir"`
+		EvictionPolicy       string `yaml:"evictionPolicy"`     // lru, lfu, 2q или arc
+		MemoryCacheSize      int    `yaml:"memoryCacheSize"`    // в мегабайтах, 0 отключает уровень в памяти
+		OriginalsCacheSize   int    `yaml:"originalsCacheSize"` // 0 отключает хранение оригиналов
+		OriginalsCacheDir    string `yaml:"originalsCacheDir"`
 		DefaultImageQuality  int    `yaml:"defaultImageQuality"`
-		MaxUploadedImageSize int    `yaml:"maxUploadedImageSize"` // in megabytes
-		ReadTimeout          int    `yaml:"readTimeout"`
+		MaxUploadedImageSize int    `yaml:"maxUploadedImageSize"` // в мегабайтах
+		ReadTimeout          int    `yaml:"readTimeout"`          // в секундах, устарело: если не задан upstream.timeout
+		DefaultTTL           int    `yaml:"defaultTTL"`           // в секундах, 0 - варианты в кэше не устаревают
+		StaleWhileRevalidate int    `yaml:"staleWhileRevalidate"` // в секундах
+		NegativeTTL          int    `yaml:"negativeTTL"`          // в секундах, 0 отключает запоминание ошибок источников
 	} `yaml:"storage"`
 }
 
+// Default возвращает конфигурацию по умолчанию. Настройки, которых нет в файле, сохраняют эти значения.
+func Default() *Config {
+	cfg := &Config{}
+	cfg.Logger.Level = "info"
+	cfg.Logger.Sampling.Initial = 100
+	cfg.Logger.Sampling.Thereafter = 100
+	cfg.Logger.File.MaxSize = 100
+	cfg.Logger.File.MaxBackups = 5
+	cfg.Logger.File.MaxAge = 30
+	cfg.Logger.File.Compress = true
+
+	cfg.Server = ServerConfig{
+		Port:              8080,
+		ReadHeaderTimeout: 5,
+		ReadTimeout:       10,
+		WriteTimeout:      30,
+		IdleTimeout:       60,
+		RequestTimeout:    25,
+		ShutdownTimeout:   30,
+	}
+	cfg.Admin.Port = 9090
+	cfg.Health.MinFreeDiskSpace = 100
+	cfg.Reload.WatchInterval = 5
+	cfg.DPR.Max = 3
+	cfg.Tracing = TracingConfig{Endpoint: "localhost:4318", Insecure: true, File: "./traces.json", SampleRatio: 1}
+	cfg.Limits = LimitsConfig{MaxQueue: 64, MaxPixels: 100, MaxDimension: 10000, RetryAfter: 1}
+	cfg.Upstream = UpstreamConfig{
+		Timeout:             10,
+		DialTimeout:         5,
+		TLSHandshakeTimeout: 5,
+		KeepAlive:           30,
+		MaxIdleConnsPerHost: 16,
+		MaxRedirects:        5,
+		Retries:             2,
+		RetryBackoff:        100,
+		RetryMaxBackoff:     2000,
+		BreakerThreshold:    5,
+		BreakerCooldown:     30,
+	}
+
+	cfg.Storage.CacheSize = 5
+	cfg.Storage.CacheDir = "./tmp"
+	cfg.Storage.EvictionPolicy = "lru"
+	cfg.Storage.MemoryCacheSize = 64
+	cfg.Storage.OriginalsCacheSize = 20
+	cfg.Storage.OriginalsCacheDir = "./tmp/originals"
+	cfg.Storage.DefaultImageQuality = 90
+	cfg.Storage.MaxUploadedImageSize = 10
+	cfg.Storage.DefaultTTL = 86400
+	cfg.Storage.StaleWhileRevalidate = 600
+	cfg.Storage.NegativeTTL = 30
+	return cfg
+}
+
+// LoadConfig читает файл конфигурации поверх значений по умолчанию. Неизвестные ключи считаются ошибкой,
+// чтобы опечатка в имени настройки не проходила незамеченной. Значения проверяет Validate.
 func LoadConfig(filePath string) (*Config, error) {
 	// Проверка существования файла
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
@@ -43,10 +207,12 @@ func LoadConfig(filePath string) (*Config, error) {
 	}
 
 	// Парсинг YAML
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	cfg := Default()
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
-	return &cfg, nil
+	return cfg, nil
 }
@@ -0,0 +1,250 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/pflag" //nolint:depguard
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// EnvPrefix - префикс переменных окружения с настройками.
+	EnvPrefix = "RESIZER_"
+	// DefaultFile - файл конфигурации по умолчанию.
+	DefaultFile = "./config/config.yaml"
+	// FileFlag - флаг с путем к файлу конфигурации. Путь можно задать и в RESIZER_CONFIG.
+	FileFlag = "config"
+
+	redacted = "REDACTED"
+)
+
+// field - настройка, которую можно переопределить флагом командной строки и переменной окружения.
+type field struct {
+	path   string // путь в YAML, например server.port
+	flag   string // имя флага, например server.port или storage.cache-dir
+	env    string // имя переменной окружения, например RESIZER_STORAGE_CACHE_DIR
+	secret bool   // значение не выводится
+	value  reflect.Value
+}
+
+// fields перечисляет все настройки cfg в порядке объявления.
+func fields(cfg *Config) []field {
+	return appendFields(nil, reflect.ValueOf(cfg).Elem(), nil)
+}
+
+func appendFields(out []field, v reflect.Value, path []string) []field {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		p := append(path[:len(path):len(path)], name)
+		if sf.Type.Kind() == reflect.Struct {
+			out = appendFields(out, v.Field(i), p)
+			continue
+		}
+
+		flagParts := make([]string, len(p))
+		envParts := make([]string, len(p))
+		for j, part := range p {
+			words := splitCamel(part)
+			flagParts[j] = strings.ToLower(strings.Join(words, "-"))
+			envParts[j] = strings.ToUpper(strings.Join(words, "_"))
+		}
+		out = append(out, field{
+			path:   strings.Join(p, "."),
+			flag:   strings.Join(flagParts, "."),
+			env:    EnvPrefix + strings.Join(envParts, "_"),
+			secret: sf.Tag.Get("secret") == "true",
+			value:  v.Field(i),
+		})
+	}
+	return out
+}
+
+// splitCamel разбивает имя в camelCase на слова: maxIdleConnsPerHost -> max, Idle, Conns, Per, Host.
+// Аббревиатуры не разбиваются: defaultTTL -> default, TTL.
+func splitCamel(s string) []string {
+	var words []string
+	runes := []rune(s)
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		lowerToUpper := unicode.IsLower(runes[i-1]) && unicode.IsUpper(runes[i])
+		acronymEnd := i+1 < len(runes) && unicode.IsUpper(runes[i-1]) && unicode.IsUpper(runes[i]) &&
+			unicode.IsLower(runes[i+1])
+		if lowerToUpper || acronymEnd {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	return append(words, string(runes[start:]))
+}
+
+// scalar сообщает, что настройку можно задать одним значением во флаге или переменной окружения.
+func (f field) scalar() bool {
+	switch f.value.Kind() { //nolint:exhaustive // остальные типы задаются только в файле
+	case reflect.String, reflect.Int, reflect.Bool, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// set разбирает raw и записывает значение в настройку.
+func (f field) set(raw string) error {
+	switch f.value.Kind() { //nolint:exhaustive // в конфигурации только эти типы
+	case reflect.String:
+		f.value.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("%s: invalid integer %q", f.path, raw)
+		}
+		f.value.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("%s: invalid boolean %q", f.path, raw)
+		}
+		f.value.SetBool(b)
+	case reflect.Float64:
+		x, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return fmt.Errorf("%s: invalid number %q", f.path, raw)
+		}
+		f.value.SetFloat(x)
+	default:
+		return fmt.Errorf("%s: unsupported type %s", f.path, f.value.Type())
+	}
+	return nil
+}
+
+// flagValue хранит значение флага до загрузки конфигурации: флаги разбираются раньше,
+// чем становится известен файл конфигурации, а применяются поверх него.
+type flagValue struct {
+	typ string
+	raw string
+}
+
+func (v *flagValue) String() string { return v.raw }
+func (v *flagValue) Type() string   { return v.typ }
+func (v *flagValue) Set(s string) error {
+	v.raw = s
+	return nil
+}
+
+// BindFlags регистрирует флаг --config и флаги для всех настроек. Значения флагов
+// применяются в Load.
+func BindFlags(fs *pflag.FlagSet) {
+	fs.String(FileFlag, DefaultFile, "path to the config file, env "+EnvPrefix+"CONFIG")
+	for _, f := range fields(&Config{}) {
+		if !f.scalar() {
+			continue
+		}
+		typ := f.value.Kind().String()
+		if typ == "float64" {
+			typ = "float"
+		}
+		flag := fs.VarPF(&flagValue{typ: typ}, f.flag, "", fmt.Sprintf("overrides %s, env %s", f.path, f.env))
+		if f.value.Kind() == reflect.Bool {
+			flag.NoOptDefVal = "true"
+		}
+	}
+}
+
+// Load загружает конфигурацию. Каждая настройка берется из первого источника, где она задана:
+// флаг командной строки, переменная окружения RESIZER_*, файл конфигурации, значение по умолчанию.
+// Итоговая конфигурация проверяется Validate.
+// Файл задается флагом --config или переменной RESIZER_CONFIG. fs - флаги, зарегистрированные BindFlags,
+// может быть nil.
+func Load(fs *pflag.FlagSet) (*Config, error) {
+	path := DefaultFile
+	if env, ok := os.LookupEnv(EnvPrefix + "CONFIG"); ok {
+		path = env
+	}
+	if fs != nil && fs.Changed(FileFlag) {
+		path, _ = fs.GetString(FileFlag)
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if fs != nil {
+		if err := cfg.applyFlags(fs); err != nil {
+			return nil, err
+		}
+	}
+	cfg.File = path
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyEnv применяет переменные окружения RESIZER_*.
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	for _, f := range fields(c) {
+		if !f.scalar() {
+			continue
+		}
+		if raw, ok := lookup(f.env); ok {
+			if err := f.set(raw); err != nil {
+				return fmt.Errorf("invalid %s: %w", f.env, err)
+			}
+		}
+	}
+	return nil
+}
+
+// applyFlags применяет флаги, заданные в командной строке.
+func (c *Config) applyFlags(fs *pflag.FlagSet) error {
+	for _, f := range fields(c) {
+		flag := fs.Lookup(f.flag)
+		if flag == nil || !flag.Changed {
+			continue
+		}
+		if err := f.set(flag.Value.String()); err != nil {
+			return fmt.Errorf("invalid --%s: %w", f.flag, err)
+		}
+	}
+	return nil
+}
+
+// Diff возвращает пути в YAML настроек, значения которых в c и other различаются.
+func (c *Config) Diff(other *Config) []string {
+	before, after := fields(c), fields(other)
+	var changed []string
+	for i := range before {
+		if !reflect.DeepEqual(before[i].value.Interface(), after[i].value.Interface()) {
+			changed = append(changed, before[i].path)
+		}
+	}
+	return changed
+}
+
+// Redacted возвращает копию конфигурации, в которой скрыты секреты.
+func (c *Config) Redacted() *Config {
+	cp := *c
+	for _, f := range fields(&cp) {
+		if f.secret && !f.value.IsZero() {
+			f.value.SetString(redacted)
+		}
+	}
+	return &cp
+}
+
+// YAML возвращает конфигурацию в формате файла конфигурации со скрытыми секретами.
+func (c *Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c.Redacted())
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"              //nolint:depguard
+	"github.com/stretchr/testify/require" //nolint:depguard
+)
+
+func TestSplitCamel(t *testing.T) {
+	require.Equal(t, []string{"max", "Idle", "Conns", "Per", "Host"}, splitCamel("maxIdleConnsPerHost"))
+	require.Equal(t, []string{"default", "TTL"}, splitCamel("defaultTTL"))
+	require.Equal(t, []string{"port"}, splitCamel("port"))
+}
+
+func TestFields_names(t *testing.T) {
+	byPath := map[string]field{}
+	for _, f := range fields(&Config{}) {
+		byPath[f.path] = f
+	}
+
+	f := byPath["storage.cacheDir"]
+	require.Equal(t, "storage.cache-dir", f.flag)
+	require.Equal(t, "RESIZER_STORAGE_CACHE_DIR", f.env)
+
+	f = byPath["storage.defaultTTL"]
+	require.Equal(t, "storage.default-ttl", f.flag)
+	require.Equal(t, "RESIZER_STORAGE_DEFAULT_TTL", f.env)
+
+	require.True(t, byPath["admin.token"].secret)
+	require.NotContains(t, byPath, "file")
+}
+
+func TestLoad_precedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := []byte("server:\n  port: 8080\n  host: file\nstorage:\n  cacheDir: ./file\nadmin:\n  token: from-file\n")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	t.Setenv("RESIZER_CONFIG", path)
+	t.Setenv("RESIZER_SERVER_PORT", "8081")
+	t.Setenv("RESIZER_STORAGE_CACHE_DIR", "./env")
+
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	BindFlags(fs)
+	require.NoError(t, fs.Parse([]string{"--server.port", "8082", "--tracing.insecure"}))
+
+	cfg, err := Load(fs)
+	require.NoError(t, err)
+	require.Equal(t, path, cfg.File)
+	require.Equal(t, 8082, cfg.Server.Port)         // флаг
+	require.Equal(t, "./env", cfg.Storage.CacheDir) // переменная окружения
+	require.Equal(t, "file", cfg.Server.Host)       // файл
+	require.True(t, cfg.Tracing.Insecure)
+
+	t.Setenv("RESIZER_SERVER_PORT", "abc")
+	_, err = Load(nil)
+	require.ErrorContains(t, err, "RESIZER_SERVER_PORT")
+}
+
+func TestConfig_Redacted(t *testing.T) {
+	cfg := &Config{}
+	cfg.Admin.Token = "secret"
+	cfg.Server.Port = 8080
+
+	out, err := cfg.YAML()
+	require.NoError(t, err)
+	require.Contains(t, string(out), "token: "+redacted)
+	require.NotContains(t, string(out), "secret")
+	require.Equal(t, "secret", cfg.Admin.Token)
+
+	cfg.Admin.Token = ""
+	require.Empty(t, cfg.Redacted().Admin.Token)
+}
+
+func TestConfig_Diff(t *testing.T) {
+	before := Default()
+	after := Default()
+	require.Empty(t, before.Diff(after))
+
+	after.Logger.Level = "debug"
+	after.Storage.CacheDir = "./other"
+	after.File = "./other.yaml"
+	require.Equal(t, []string{"logger.level", "storage.cacheDir"}, before.Diff(after))
+}
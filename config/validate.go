@@ -0,0 +1,197 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const (
+	maxPort = 65535
+	maxDPR  = 4
+)
+
+// FieldError - ошибка в значении одной настройки.
+type FieldError struct {
+	Path    string // путь в YAML, например storage.cacheSize
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError перечисляет все ошибки, найденные Validate.
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	lines := make([]string, 0, len(e)+1)
+	lines = append(lines, "invalid config:")
+	for _, fe := range e {
+		lines = append(lines, "  "+fe.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validator накапливает ошибки, чтобы сообщить обо всех сразу.
+type validator struct {
+	errs ValidationError
+}
+
+func (v *validator) fail(path, format string, args ...any) {
+	v.errs = append(v.errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) nonNegative(path string, n int) {
+	if n < 0 {
+		v.fail(path, "must not be negative, got %d", n)
+	}
+}
+
+func (v *validator) positive(path string, n int) {
+	if n <= 0 {
+		v.fail(path, "must be positive, got %d", n)
+	}
+}
+
+func (v *validator) between(path string, n, lo, hi int) {
+	if n < lo || n > hi {
+		v.fail(path, "must be between %d and %d, got %d", lo, hi, n)
+	}
+}
+
+func (v *validator) required(path, s string) {
+	if strings.TrimSpace(s) == "" {
+		v.fail(path, "must not be empty")
+	}
+}
+
+func (v *validator) oneOf(path, s string, allowed ...string) {
+	if !slices.Contains(allowed, s) {
+		v.fail(path, "must be one of %s, got %q", strings.Join(allowed, ", "), s)
+	}
+}
+
+func (v *validator) preset(path, name string, p PresetConfig, maxDimension int) {
+	if name == "" || strings.ContainsAny(name, "/ ") {
+		v.fail(path, "name must be non-empty and must not contain slashes or spaces")
+	}
+	if maxDimension > 0 {
+		v.between(path+".width", p.Width, 0, maxDimension)
+		v.between(path+".height", p.Height, 0, maxDimension)
+	} else {
+		v.nonNegative(path+".width", p.Width)
+		v.nonNegative(path+".height", p.Height)
+	}
+	v.oneOf(path+".mode", p.Mode, "", "resize", "fit", "fill")
+	// Без режима 0 означает размер по пропорциям, а оба 0 - исходный размер
+	if p.Mode == "fit" || p.Mode == "fill" {
+		v.positive(path+".width", p.Width)
+		v.positive(path+".height", p.Height)
+	}
+	v.oneOf(path+".gravity", p.Gravity, "", "center", "north", "south", "east", "west",
+		"northeast", "northwest", "southeast", "southwest")
+	v.between(path+".quality", p.Quality, 0, 100)
+	v.oneOf(path+".format", p.Format, "", "jpeg", "png", "gif")
+}
+
+// Validate проверяет значения настроек и возвращает ValidationError со всеми найденными ошибками.
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	v.oneOf("logger.level", c.Logger.Level, "error", "warn", "info", "debug")
+	v.nonNegative("logger.sampling.initial", c.Logger.Sampling.Initial)
+	v.nonNegative("logger.sampling.thereafter", c.Logger.Sampling.Thereafter)
+	v.nonNegative("logger.file.maxSize", c.Logger.File.MaxSize)
+	v.nonNegative("logger.file.maxBackups", c.Logger.File.MaxBackups)
+	v.nonNegative("logger.file.maxAge", c.Logger.File.MaxAge)
+
+	v.between("server.port", c.Server.Port, 1, maxPort)
+	v.nonNegative("server.readHeaderTimeout", c.Server.ReadHeaderTimeout)
+	v.nonNegative("server.readTimeout", c.Server.ReadTimeout)
+	v.nonNegative("server.writeTimeout", c.Server.WriteTimeout)
+	v.nonNegative("server.idleTimeout", c.Server.IdleTimeout)
+	v.nonNegative("server.requestTimeout", c.Server.RequestTimeout)
+	v.nonNegative("server.shutdownTimeout", c.Server.ShutdownTimeout)
+	v.nonNegative("server.drainDelay", c.Server.DrainDelay)
+
+	v.between("admin.port", c.Admin.Port, 0, maxPort)
+	if c.Admin.Port != 0 && c.Admin.Port == c.Server.Port && c.Admin.Host == c.Server.Host {
+		v.fail("admin.port", "must differ from server.port")
+	}
+
+	v.nonNegative("health.minFreeDiskSpace", c.Health.MinFreeDiskSpace)
+
+	v.oneOf("tracing.exporter", c.Tracing.Exporter, "", "otlp", "stdout", "file")
+	if c.Tracing.Exporter == "file" {
+		v.required("tracing.file", c.Tracing.File)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		v.fail("tracing.sampleRatio", "must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+	}
+
+	v.nonNegative("limits.maxConcurrency", c.Limits.MaxConcurrency)
+	v.nonNegative("limits.maxQueue", c.Limits.MaxQueue)
+	v.nonNegative("limits.maxPixels", c.Limits.MaxPixels)
+	v.nonNegative("limits.maxDimension", c.Limits.MaxDimension)
+	v.nonNegative("limits.retryAfter", c.Limits.RetryAfter)
+
+	v.nonNegative("upstream.timeout", c.Upstream.Timeout)
+	v.nonNegative("upstream.dialTimeout", c.Upstream.DialTimeout)
+	v.nonNegative("upstream.tlsHandshakeTimeout", c.Upstream.TLSHandshakeTimeout)
+	v.nonNegative("upstream.keepAlive", c.Upstream.KeepAlive)
+	v.nonNegative("upstream.maxIdleConnsPerHost", c.Upstream.MaxIdleConnsPerHost)
+	v.nonNegative("upstream.maxRedirects", c.Upstream.MaxRedirects)
+	v.nonNegative("upstream.retries", c.Upstream.Retries)
+	v.nonNegative("upstream.retryBackoff", c.Upstream.RetryBackoff)
+	v.nonNegative("upstream.retryMaxBackoff", c.Upstream.RetryMaxBackoff)
+	v.nonNegative("upstream.breakerThreshold", c.Upstream.BreakerThreshold)
+	v.nonNegative("upstream.breakerCooldown", c.Upstream.BreakerCooldown)
+	if c.Upstream.Proxy != "" {
+		if u, err := url.Parse(c.Upstream.Proxy); err != nil || u.Scheme == "" || u.Host == "" {
+			v.fail("upstream.proxy", "must be an absolute URL, got %q", c.Upstream.Proxy)
+		}
+	}
+
+	if c.DPR.Max < 1 || c.DPR.Max > maxDPR {
+		v.fail("dpr.max", "must be between 1 and %d, got %g", maxDPR, c.DPR.Max)
+	}
+
+	v.nonNegative("reload.watchInterval", c.Reload.WatchInterval)
+
+	names := make([]string, 0, len(c.Presets))
+	for name := range c.Presets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		v.preset("presets."+name, name, c.Presets[name], c.Limits.MaxDimension)
+	}
+	if c.Limits.PresetsOnly && len(c.Presets) == 0 {
+		v.fail("limits.presetsOnly", "requires at least one preset")
+	}
+
+	v.positive("storage.cacheSize", c.Storage.CacheSize)
+	v.required("storage.cacheDir", c.Storage.CacheDir)
+	v.oneOf("storage.evictionPolicy", c.Storage.EvictionPolicy, "lru", "lfu", "2q", "arc")
+	v.nonNegative("storage.memoryCacheSize", c.Storage.MemoryCacheSize)
+	v.nonNegative("storage.originalsCacheSize", c.Storage.OriginalsCacheSize)
+	if c.Storage.OriginalsCacheSize > 0 {
+		v.required("storage.originalsCacheDir", c.Storage.OriginalsCacheDir)
+		if c.Storage.OriginalsCacheDir == c.Storage.CacheDir {
+			v.fail("storage.originalsCacheDir", "must differ from storage.cacheDir")
+		}
+	}
+	v.between("storage.defaultImageQuality", c.Storage.DefaultImageQuality, 1, 100)
+	v.positive("storage.maxUploadedImageSize", c.Storage.MaxUploadedImageSize)
+	v.nonNegative("storage.readTimeout", c.Storage.ReadTimeout)
+	v.nonNegative("storage.defaultTTL", c.Storage.DefaultTTL)
+	v.nonNegative("storage.staleWhileRevalidate", c.Storage.StaleWhileRevalidate)
+	v.nonNegative("storage.negativeTTL", c.Storage.NegativeTTL)
+
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+	return nil
+}
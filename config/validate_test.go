@@ -0,0 +1,140 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require" //nolint:depguard
+)
+
+func writeConfig(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+	return path
+}
+
+func TestDefault_valid(t *testing.T) {
+	require.NoError(t, Default().Validate())
+}
+
+func TestLoadConfig_defaults(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, "server:\n  port: 8081\nstorage:\n  memoryCacheSize: 0\n"))
+	require.NoError(t, err)
+	require.Equal(t, 8081, cfg.Server.Port)
+	require.Equal(t, 0, cfg.Storage.MemoryCacheSize) // явный 0 не заменяется значением по умолчанию
+	require.Equal(t, Default().Server.ReadTimeout, cfg.Server.ReadTimeout)
+	require.Equal(t, Default().Storage.CacheDir, cfg.Storage.CacheDir)
+
+	cfg, err = LoadConfig(writeConfig(t, ""))
+	require.NoError(t, err)
+	require.Equal(t, Default(), cfg)
+}
+
+func TestLoadConfig_unknownKey(t *testing.T) {
+	_, err := LoadConfig(writeConfig(t, "server:\n  prot: 8081\n"))
+	require.ErrorContains(t, err, "field prot not found")
+}
+
+func TestConfig_Validate(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Port = -1
+	cfg.Storage.CacheSize = 0
+	cfg.Storage.CacheDir = ""
+	cfg.Storage.EvictionPolicy = "fifo"
+	cfg.Tracing.SampleRatio = 2
+	cfg.Upstream.Proxy = "proxy:3128"
+
+	err := cfg.Validate()
+	var invalid ValidationError
+	require.True(t, errors.As(err, &invalid))
+
+	paths := make([]string, 0, len(invalid))
+	for _, fe := range invalid {
+		paths = append(paths, fe.Path)
+	}
+	require.Equal(t, []string{
+		"server.port",
+		"tracing.sampleRatio",
+		"upstream.proxy",
+		"storage.cacheSize",
+		"storage.cacheDir",
+		"storage.evictionPolicy",
+	}, paths)
+	require.Contains(t, err.Error(), "server.port: must be between 1 and 65535, got -1")
+}
+
+func TestConfig_Validate_dependent(t *testing.T) {
+	cfg := Default()
+	cfg.Admin.Port = cfg.Server.Port
+	cfg.Tracing.Exporter = "file"
+	cfg.Tracing.File = ""
+	cfg.Storage.OriginalsCacheDir = cfg.Storage.CacheDir
+
+	var invalid ValidationError
+	require.True(t, errors.As(cfg.Validate(), &invalid))
+	require.Len(t, invalid, 3)
+
+	cfg.Admin.Port = 0
+	cfg.Tracing.Exporter = ""
+	cfg.Storage.OriginalsCacheSize = 0
+	require.NoError(t, cfg.Validate())
+}
+
+func TestConfig_Validate_originals(t *testing.T) {
+	paths := func(cfg *Config) []string {
+		var invalid ValidationError
+		require.True(t, errors.As(cfg.Validate(), &invalid))
+		paths := make([]string, 0, len(invalid))
+		for _, fe := range invalid {
+			paths = append(paths, fe.Path)
+		}
+		return paths
+	}
+
+	cfg := Default()
+	cfg.Storage.OriginalsCacheDir = ""
+	require.Equal(t, []string{"storage.originalsCacheDir"}, paths(cfg))
+
+	cfg.Storage.OriginalsCacheDir = cfg.Storage.CacheDir
+	require.Equal(t, []string{"storage.originalsCacheDir"}, paths(cfg))
+
+	cfg.Storage.OriginalsCacheSize = -1
+	require.Equal(t, []string{"storage.originalsCacheSize"}, paths(cfg))
+
+	// Без хранилища оригиналов директория не нужна
+	cfg.Storage.OriginalsCacheSize = 0
+	cfg.Storage.OriginalsCacheDir = ""
+	require.NoError(t, cfg.Validate())
+}
+
+func TestConfig_Validate_presets(t *testing.T) {
+	cfg := Default()
+	cfg.Limits.PresetsOnly = true
+	require.ErrorContains(t, cfg.Validate(), "limits.presetsOnly: requires at least one preset")
+
+	cfg.Presets = map[string]PresetConfig{
+		"thumb": {Width: 150, Height: 150, Mode: "fill", Gravity: "north", Quality: 80, Format: "jpeg"},
+		"wide":  {Width: 1200},
+	}
+	require.NoError(t, cfg.Validate())
+
+	cfg.Presets["bad"] = PresetConfig{Width: 100, Mode: "crop", Quality: 101, Format: "webp"}
+	cfg.Presets["fit"] = PresetConfig{Width: 100, Mode: "fit"}
+	cfg.Presets["huge"] = PresetConfig{Width: cfg.Limits.MaxDimension + 1}
+	var invalid ValidationError
+	require.True(t, errors.As(cfg.Validate(), &invalid))
+	paths := make([]string, 0, len(invalid))
+	for _, fe := range invalid {
+		paths = append(paths, fe.Path)
+	}
+	require.Equal(t, []string{
+		"presets.bad.mode",
+		"presets.bad.quality",
+		"presets.bad.format",
+		"presets.fit.height",
+		"presets.huge.width",
+	}, paths)
+}
@@ -0,0 +1,152 @@
+package cache
+
+import "time"
+
+type Cache interface {
+	Set(key string, data []byte) error
+	// SetWithTTL сохраняет данные, которые считаются свежими в течение ttl.
+	SetWithTTL(key string, data []byte, ttl time.Duration) error
+	// Get возвращает данные, если их можно отдать клиенту (свежие или устаревшие в пределах окна).
+	Get(key string) ([]byte, bool)
+	// Lookup возвращает запись вместе с её состоянием свежести.
+	Lookup(key string) (Entry, State)
+	// Delete удаляет запись и возвращает true, если она была в кэше.
+	Delete(key string) bool
+	// DeleteByPrefix удаляет все записи, ключ которых начинается с prefix, и возвращает их количество.
+	DeleteByPrefix(prefix string) int
+	// Clear удаляет все записи вместе с файлами на диске.
+	Clear() error
+	// Flush сохраняет на диск все, что нужно для восстановления кэша после перезапуска.
+	Flush() error
+	// Stats возвращает статистику кэша по уровням.
+	Stats() Stats
+}
+
+// TierStats содержит статистику одного уровня кэша: счётчики попаданий, промахов
+// и вытеснений, а также текущее число записей и их суммарный размер.
+type TierStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+	Bytes     int64
+}
+
+// Stats содержит статистику кэша по уровням. У дискового кэша заполнен только Disk.
+type Stats struct {
+	Memory TierStats
+	Disk   TierStats
+}
+
+// State описывает свежесть найденной в кэше записи.
+type State int
+
+const (
+	// Miss - записи нет или она устарела дольше окна stale-while-revalidate.
+	Miss State = iota
+	// Fresh - запись свежая.
+	Fresh
+	// Stale - срок годности истёк, но запись ещё можно отдать, пока она обновляется в фоне.
+	Stale
+)
+
+func (s State) String() string {
+	switch s {
+	case Miss:
+		return "miss"
+	case Fresh:
+		return "fresh"
+	case Stale:
+		return "stale"
+	default:
+		return "unknown"
+	}
+}
+
+// Entry - запись кэша.
+type Entry struct {
+	Data      []byte
+	ExpiresAt time.Time // нулевое значение означает бессрочную запись
+}
+
+// Option настраивает кэш.
+type Option func(*options)
+
+type options struct {
+	staleWindow time.Duration
+	policy      Policy
+	defaultTTL  time.Duration
+	validKey    func(key string) bool
+	legacyKey   func(key string) bool
+	now         func() time.Time
+}
+
+// WithStaleWindow задает окно stale-while-revalidate: сколько времени после истечения
+// срока годности запись ещё отдается клиентам.
+func WithStaleWindow(d time.Duration) Option {
+	return func(o *options) {
+		o.staleWindow = d
+	}
+}
+
+// WithPolicy задает политику вытеснения дискового кэша. По умолчанию используется LRU.
+func WithPolicy(policy Policy) Option {
+	return func(o *options) {
+		o.policy = policy
+	}
+}
+
+// WithDefaultTTL задает срок годности записей дискового кэша, которых нет в сохраненном индексе,
+// например записанных после последнего Flush перед аварийной остановкой. Срок отсчитывается
+// от времени изменения файла. По умолчанию такие записи бессрочные.
+func WithDefaultTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.defaultTTL = ttl
+	}
+}
+
+// WithKeyFormat задает формат ключей дискового кэша. Файлы в корне директории кэша (плоская раскладка
+// предыдущих версий) считаются записями, только если их имя подходит под формат; без формата такие
+// файлы не трогаются, чтобы не переместить и не удалить чужие файлы.
+func WithKeyFormat(valid func(key string) bool) Option {
+	return func(o *options) {
+		o.validKey = valid
+	}
+}
+
+// WithLegacyKeyFormat задает формат ключей прежних версий, которые нельзя перевести в текущий формат.
+// Такие файлы в корне директории кэша удаляются при запуске и очистке, иначе они остались бы на диске
+// навсегда.
+func WithLegacyKeyFormat(legacy func(key string) bool) Option {
+	return func(o *options) {
+		o.legacyKey = legacy
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{now: time.Now}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// state определяет свежесть записи со сроком годности expiresAt.
+func (o options) state(expiresAt time.Time) State {
+	if expiresAt.IsZero() {
+		return Fresh
+	}
+	now := o.now()
+	switch {
+	case now.Before(expiresAt):
+		return Fresh
+	case now.Before(expiresAt.Add(o.staleWindow)):
+		return Stale
+	default:
+		return Miss
+	}
+}
+
+func (o options) expiresAt(ttl time.Duration) time.Time {
+	return o.now().Add(ttl)
+}
@@ -0,0 +1,454 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// tmpPrefix - префикс временных файлов, которые еще не стали записями кэша.
+	tmpPrefix = ".tmp-"
+	// indexFile хранит сроки годности записей между перезапусками.
+	indexFile = ".index"
+)
+
+type cacheItem struct {
+	key       string
+	path      string
+	size      int64
+	expiresAt time.Time
+}
+
+// diskCache хранит записи в файлах, а порядок вытеснения определяет политика.
+type diskCache struct {
+	dir      string
+	capacity int
+	policy   Policy
+	items    map[string]*cacheItem
+	opts     options
+	mu       sync.Mutex
+
+	bytes     int64  // суммарный размер файлов записей, под блокировкой
+	evictions uint64 // под блокировкой
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+}
+
+// NewCache создает дисковый кэш на capacity записей в директории dir.
+// Записи, оставшиеся в директории от предыдущих запусков, снова попадают в кэш.
+func NewCache(capacity int, dir string, opts ...Option) (Cache, error) {
+	// Создаем директорию для кэша, если её нет
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	o := newOptions(opts)
+	if o.policy == nil {
+		o.policy = NewLRUPolicy(capacity)
+	}
+	c := &diskCache{
+		dir:      filepath.Clean(dir),
+		capacity: capacity,
+		policy:   o.policy,
+		items:    make(map[string]*cacheItem, capacity),
+		opts:     o,
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *diskCache) Set(key string, data []byte) error {
+	return c.set(key, data, time.Time{})
+}
+
+func (c *diskCache) SetWithTTL(key string, data []byte, ttl time.Duration) error {
+	return c.set(key, data, c.opts.expiresAt(ttl))
+}
+
+func (c *diskCache) set(key string, data []byte, expiresAt time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Создаем путь к файлу на основе хэша
+	filePath := fanOutPath(c.dir, key)
+	if err := writeFileAtomic(filePath, data); err != nil {
+		return err
+	}
+
+	size := int64(len(data))
+	if item, found := c.items[key]; found {
+		// обновляем запись и отмечаем обращение
+		item.path = filePath
+		item.expiresAt = expiresAt
+		c.bytes += size - item.size
+		item.size = size
+		c.policy.Hit(key)
+		return nil
+	}
+
+	c.add(&cacheItem{key: key, path: filePath, size: size, expiresAt: expiresAt})
+	return nil
+}
+
+// add добавляет запись в индекс и удаляет записи, которые выбрала политика вытеснения.
+// Вызывается под блокировкой.
+func (c *diskCache) add(item *cacheItem) {
+	c.items[item.key] = item
+	c.bytes += item.size
+	for _, evicted := range c.policy.Add(item.key) {
+		if item, found := c.items[evicted]; found {
+			c.remove(item)
+			c.evictions++
+		}
+	}
+}
+
+func (c *diskCache) Get(key string) ([]byte, bool) {
+	entry, state := c.Lookup(key)
+	if state == Miss {
+		return nil, false
+	}
+	return entry.Data, true
+}
+
+func (c *diskCache) Lookup(key string) (Entry, State) {
+	c.mu.Lock()
+	item, found := c.items[key]
+	if !found {
+		c.mu.Unlock()
+		c.misses.Add(1)
+		return Entry{}, Miss
+	}
+
+	state := c.opts.state(item.expiresAt)
+	if state == Miss {
+		// Запись устарела окончательно - освобождаем место
+		c.policy.Remove(key)
+		c.remove(item)
+		c.mu.Unlock()
+		c.misses.Add(1)
+		return Entry{}, Miss
+	}
+
+	c.policy.Hit(key)
+	path, expiresAt := item.path, item.expiresAt
+	c.mu.Unlock()
+
+	// Файл читается без блокировки: запись заменяет его атомарно, а если файл успели удалить,
+	// это обычный промах
+	data, err := os.ReadFile(path)
+	if err != nil {
+		c.misses.Add(1)
+		return Entry{}, Miss
+	}
+	c.hits.Add(1)
+	return Entry{Data: data, ExpiresAt: expiresAt}, state
+}
+
+func (c *diskCache) Delete(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, found := c.items[key]
+	if found {
+		c.policy.Remove(key)
+		c.remove(item)
+	}
+	return found
+}
+
+func (c *diskCache) DeleteByPrefix(prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deleted := 0
+	for key, item := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			c.policy.Remove(key)
+			c.remove(item)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// Clear удаляет все записи кэша с диска, в том числе оставшиеся от предыдущих запусков. Чужие файлы
+// в директории кэша не удаляются. Читатели, которые уже открыли файл, дочитают его до конца:
+// файл исчезает только из директории.
+func (c *diskCache) Clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.items {
+		c.policy.Remove(key)
+	}
+	c.items = make(map[string]*cacheItem, c.capacity)
+	c.bytes = 0
+
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	remove := func(dir string, entry os.DirEntry) error {
+		name := entry.Name()
+		obsolete := strings.HasPrefix(name, tmpPrefix) || dir == c.dir && name == indexFile || c.isLegacy(dir, name)
+		if obsolete || c.isEntry(dir, name) {
+			if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return nil
+	}
+	for _, entry := range entries {
+		switch {
+		case entry.Type().IsRegular():
+			_ = remove(c.dir, entry)
+		case entry.IsDir() && isFanOutDir(entry.Name()):
+			dir := filepath.Join(c.dir, entry.Name())
+			if err := c.walkFanOutDir(dir, remove); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			removeEmptyDirs(dir)
+		}
+	}
+	return firstErr
+}
+
+func (c *diskCache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{Disk: TierStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions,
+		Entries:   len(c.items),
+		Bytes:     c.bytes,
+	}}
+}
+
+// Flush сохраняет сроки годности записей, чтобы после перезапуска они не стали бессрочными.
+// Бессрочные записи тоже попадают в индекс: так их можно отличить от записей, появившихся
+// после последнего Flush.
+func (c *diskCache) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	index := make(map[string]time.Time, len(c.items))
+	for key, item := range c.items {
+		index[key] = item.expiresAt
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(c.dir, indexFile), data)
+}
+
+// readIndex читает сроки годности, сохраненные Flush. Отсутствие или повреждение индекса
+// не мешает запуску: срок годности записей, которых нет в индексе, определяет expiresAt.
+func (c *diskCache) readIndex() map[string]time.Time {
+	index := make(map[string]time.Time)
+	data, err := os.ReadFile(filepath.Join(c.dir, indexFile))
+	if err != nil {
+		return index
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return make(map[string]time.Time)
+	}
+	return index
+}
+
+// expiresAt возвращает срок годности записи key по индексу. Записи, которой нет в индексе, срок
+// отсчитывается от времени изменения файла modTime.
+func (c *diskCache) expiresAt(index map[string]time.Time, key string, modTime time.Time) time.Time {
+	if expiresAt, found := index[key]; found || c.opts.defaultTTL <= 0 {
+		return expiresAt
+	}
+	return modTime.Add(c.opts.defaultTTL)
+}
+
+// fanOutPath возвращает путь к файлу записи. Файлы раскладываются по двум уровням поддиректорий
+// по префиксу хэша ключа, чтобы в одной директории не скапливались сотни тысяч файлов.
+func fanOutPath(dir, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	prefix := hex.EncodeToString(sum[:2])
+	return filepath.Join(dir, prefix[:2], prefix[2:], key)
+}
+
+// isFanOutDir проверяет, что имя директории - двухсимвольный шестнадцатеричный префикс.
+// Остальные поддиректории (например, хранилище оригиналов) кэшу не принадлежат.
+func isFanOutDir(name string) bool {
+	if len(name) != 2 {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil && strings.ToLower(name) == name
+}
+
+// isEntry проверяет, что файл name в директории dir - запись кэша. В поддиректориях запись лежит
+// по пути, который вычисляется из её ключа, а в корне допустимы только ключи в формате WithKeyFormat.
+func (c *diskCache) isEntry(dir, name string) bool {
+	if dir == c.dir {
+		return name != indexFile && c.opts.validKey != nil && c.opts.validKey(name)
+	}
+	return filepath.Join(dir, name) == fanOutPath(c.dir, name)
+}
+
+// isLegacy проверяет, что файл name в директории dir - запись прежней версии в формате
+// WithLegacyKeyFormat, которую нельзя перенести под текущий ключ.
+func (c *diskCache) isLegacy(dir, name string) bool {
+	return dir == c.dir && c.opts.legacyKey != nil && c.opts.legacyKey(name)
+}
+
+// removeEmptyDirs удаляет опустевшие поддиректории второго уровня и саму директорию dir.
+// Директории с чужими файлами остаются.
+func removeEmptyDirs(dir string) {
+	subdirs, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, subdir := range subdirs {
+		if subdir.IsDir() && isFanOutDir(subdir.Name()) {
+			_ = os.Remove(filepath.Join(dir, subdir.Name()))
+		}
+	}
+	_ = os.Remove(dir)
+}
+
+// load поднимает в индекс записи, оставшиеся на диске от предыдущих запусков: сначала самые
+// давние, чтобы при нехватке места вытеснялись именно они. Файлы старой плоской раскладки
+// переносятся в поддиректории, а записи с ключами прежнего формата и недописанные временные файлы
+// удаляются. Чужие файлы не трогаются.
+func (c *diskCache) load() error {
+	var items []*cacheItem
+	modTimes := make(map[string]time.Time)
+	index := c.readIndex()
+
+	collect := func(dir string, entry os.DirEntry) error {
+		path := filepath.Join(dir, entry.Name())
+		switch {
+		case strings.HasPrefix(entry.Name(), tmpPrefix) || c.isLegacy(dir, entry.Name()):
+			return os.Remove(path)
+		case !c.isEntry(dir, entry.Name()):
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		target := fanOutPath(c.dir, entry.Name())
+		if target != path {
+			if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+				return err
+			}
+			if err := os.Rename(path, target); err != nil {
+				return err
+			}
+		}
+		items = append(items, &cacheItem{
+			key:       entry.Name(),
+			path:      target,
+			size:      info.Size(),
+			expiresAt: c.expiresAt(index, entry.Name(), info.ModTime()),
+		})
+		modTimes[entry.Name()] = info.ModTime()
+		return nil
+	}
+
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		switch {
+		case entry.Type().IsRegular():
+			err = collect(c.dir, entry)
+		case entry.IsDir() && isFanOutDir(entry.Name()):
+			err = c.walkFanOutDir(filepath.Join(c.dir, entry.Name()), collect)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return modTimes[items[i].key].Before(modTimes[items[j].key])
+	})
+	for _, item := range items {
+		c.add(item)
+	}
+	return nil
+}
+
+// walkFanOutDir обходит файлы двухуровневой поддиректории.
+func (c *diskCache) walkFanOutDir(dir string, fn func(dir string, entry os.DirEntry) error) error {
+	subdirs, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, subdir := range subdirs {
+		if !subdir.IsDir() || !isFanOutDir(subdir.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, subdir.Name())
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				continue
+			}
+			if err := fn(path, entry); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// tmpSeq нумерует временные файлы, чтобы параллельные записи не пересекались.
+var tmpSeq atomic.Uint64
+
+// writeFileAtomic записывает данные во временный файл и переименовывает его,
+// чтобы читатели никогда не видели частично записанный файл. Недостающие директории создаются.
+func writeFileAtomic(path string, data []byte) error {
+	tmpPath := filepath.Join(filepath.Dir(path), fmt.Sprintf("%s%d-%d", tmpPrefix, os.Getpid(), tmpSeq.Add(1)))
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			return err
+		}
+		tmp, err = os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// remove удаляет запись и её файл с диска. Опустевшие поддиректории остаются, чтобы не пересоздавать
+// их при каждой записи; их удаляет Clear. Политику вызывающий обновляет сам. Вызывается под блокировкой.
+func (c *diskCache) remove(item *cacheItem) {
+	_ = os.Remove(item.path)
+	delete(c.items, item.key)
+	c.bytes -= item.size
+}
@@ -0,0 +1,538 @@
+package cache
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require" //nolint:depguard
+)
+
+func TestLRUCache_simple(t *testing.T) {
+	// Создаем временную директорию для тестов
+	tempDir := t.TempDir()
+
+	// Инициализация LRU-кэша
+	c, err := NewCache(2, tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	// Проверяем, что ключи отсутствуют
+	_, ok := c.Get("key1")
+	require.False(t, ok)
+
+	_, ok = c.Get("key2")
+	require.False(t, ok)
+
+	// Добавляем первый элемент
+	err = c.Set("key1", []byte("value1"))
+	if err != nil {
+		t.Fatalf("Failed to set key1: %v", err)
+	}
+
+	// Проверяем получение первого элемента
+	data, ok := c.Get("key1")
+	if !ok {
+		t.Fatalf("Failed to get key1")
+	}
+	if string(data) != "value1" {
+		t.Errorf("Expected value1, got %s", string(data))
+	}
+
+	// Добавляем второй элемент
+	err = c.Set("key2", []byte("value2"))
+	if err != nil {
+		t.Fatalf("Failed to set key2: %v", err)
+	}
+
+	// Проверяем получение второго элемента
+	data, ok = c.Get("key2")
+	if !ok {
+		t.Fatalf("Failed to get key2")
+	}
+	if string(data) != "value2" {
+		t.Errorf("Expected value2, got %s", string(data))
+	}
+
+	// Добавляем третий элемент, что должно вызвать удаление "key1"
+	err = c.Set("key3", []byte("value3"))
+	if err != nil {
+		t.Fatalf("Failed to set key3: %v", err)
+	}
+
+	// Проверяем, что "key1" удален
+	_, ok = c.Get("key1")
+	if ok {
+		t.Errorf("Expected key1 to be evicted, but it was found")
+	}
+
+	// Проверяем, что "key2" и "key3" доступны
+	_, ok = c.Get("key2")
+	if !ok {
+		t.Errorf("Expected key2 to be present, but it was not found")
+	}
+	_, ok = c.Get("key3")
+	if !ok {
+		t.Errorf("Expected key3 to be present, but it was not found")
+	}
+}
+
+// Тест на логику выталкивания элементов из-за размера очереди
+// (например: n = 3, добавили 4 элемента - 1й из кэша вытолкнулся).
+func TestLRUCache_purge_logic(t *testing.T) {
+	// Создаем временную директорию для тестов
+	tempDir := t.TempDir()
+
+	// Инициализация LRU-кэша
+	c, err := NewCache(3, tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = c.Set("key1", []byte("value1"))
+	_ = c.Set("key2", []byte("value2"))
+	_ = c.Set("key3", []byte("value3"))
+	_ = c.Set("key4", []byte("value4"))
+
+	val, ok := c.Get("key1")
+	require.False(t, ok)
+	require.Nil(t, val)
+
+	_, ok = c.Get("key2")
+	require.True(t, ok)
+
+	_, ok = c.Get("key3")
+	require.True(t, ok)
+
+	_, ok = c.Get("key4")
+	require.True(t, ok)
+}
+
+// Тест на логику выталкивания давно используемых элементов
+// (например: n = 3, добавили 3 элемента, обратились несколько раз к разным элементам: изменили значение, получили
+// значение и пр. - добавили 4й элемент, из первой тройки вытолкнется тот элемент, что был затронут наиболее давно).
+func TestLRUCache_access_time(t *testing.T) {
+	// Создаем временную директорию для тестов
+	tempDir := t.TempDir()
+
+	// Инициализация LRU-кэша
+	c, err := NewCache(3, tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = c.Set("key1", []byte("value1"))
+	_ = c.Set("key2", []byte("value2"))
+	_ = c.Set("key3", []byte("value3"))
+
+	_, ok := c.Get("key1")
+	require.True(t, ok)
+
+	_, ok = c.Get("key2")
+	require.True(t, ok)
+
+	_ = c.Set("key1", []byte("value4"))
+	_ = c.Set("key2", []byte("value5"))
+
+	_, _ = c.Get("key1")
+	_, _ = c.Get("key2")
+
+	_ = c.Set("key1", []byte("value6"))
+
+	_, _ = c.Get("key1")
+
+	_ = c.Set("key4", []byte("value7"))
+
+	_, ok = c.Get("key1")
+	require.True(t, ok)
+
+	_, ok = c.Get("key2")
+	require.True(t, ok)
+
+	val, ok := c.Get("key3")
+	require.False(t, ok)
+	require.Nil(t, val)
+
+	_, ok = c.Get("key4")
+	require.True(t, ok)
+}
+
+func TestLRUCache_file(t *testing.T) {
+	// Создаем временную директорию для тестов
+	tempDir := t.TempDir()
+
+	// Инициализация LRU-кэша
+	c, err := NewCache(2, tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	// Добавляем элемент
+	err = c.Set("key1", []byte("value1"))
+	if err != nil {
+		t.Fatalf("Failed to set key1: %v", err)
+	}
+
+	// Проверяем, что файл создан на диске
+	filePath := fanOutPath(tempDir, "key1")
+	_, err = os.Stat(filePath)
+	if os.IsNotExist(err) {
+		t.Errorf("Expected file %s to exist, but it does not", filePath)
+	}
+
+	// Получаем элемент из кэша
+	data, ok := c.Get("key1")
+	if !ok {
+		t.Fatalf("Failed to get key1")
+	}
+	if string(data) != "value1" {
+		t.Errorf("Expected value1, got %s", string(data))
+	}
+}
+
+func TestCacheMultithreading(t *testing.T) {
+	// Создаем временную директорию для тестов
+	tempDir := t.TempDir()
+
+	// Инициализация LRU-кэша
+	c, err := NewCache(10, tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1_000_000; i++ {
+			key := strconv.Itoa(i)
+			err := c.Set(key, []byte(fmt.Sprintf("value%s", key)))
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1_000_000; i++ {
+			c.Get(strconv.Itoa(rand.Intn(1_000_000)))
+		}
+	}()
+
+	wg.Wait()
+
+	require.True(t, true)
+}
+
+// withTestKeys задает формат ключей, которые используются в тестах.
+var withTestKeys = WithKeyFormat(func(key string) bool { return strings.HasPrefix(key, "key") })
+
+// withClock подменяет источник текущего времени в тестах.
+func withClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
+}
+
+func TestLRUCache_ttl(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	c, err := NewCache(3, t.TempDir(), WithStaleWindow(time.Minute), withClock(clock))
+	require.NoError(t, err)
+
+	require.NoError(t, c.SetWithTTL("key1", []byte("value1"), time.Minute))
+	require.NoError(t, c.Set("key2", []byte("value2")))
+
+	entry, state := c.Lookup("key1")
+	require.Equal(t, Fresh, state)
+	require.Equal(t, "value1", string(entry.Data))
+	require.Equal(t, now.Add(time.Minute), entry.ExpiresAt)
+
+	// Срок годности истек, но запись ещё в окне stale-while-revalidate
+	now = now.Add(90 * time.Second)
+	entry, state = c.Lookup("key1")
+	require.Equal(t, Stale, state)
+	require.Equal(t, "value1", string(entry.Data))
+
+	data, ok := c.Get("key1")
+	require.True(t, ok)
+	require.Equal(t, "value1", string(data))
+
+	// Окно истекло - запись удаляется
+	now = now.Add(time.Minute)
+	_, state = c.Lookup("key1")
+	require.Equal(t, Miss, state)
+	_, ok = c.Get("key1")
+	require.False(t, ok)
+
+	// Запись без срока годности не устаревает
+	_, state = c.Lookup("key2")
+	require.Equal(t, Fresh, state)
+}
+
+func TestLRUCache_delete(t *testing.T) {
+	tempDir := t.TempDir()
+
+	c, err := NewCache(5, tempDir)
+	require.NoError(t, err)
+
+	_ = c.Set("hash1_100_100", []byte("value1"))
+	_ = c.Set("hash1_200_200", []byte("value2"))
+	_ = c.Set("hash2_100_100", []byte("value3"))
+
+	require.True(t, c.Delete("hash2_100_100"))
+	require.False(t, c.Delete("hash2_100_100"))
+
+	require.Equal(t, 2, c.DeleteByPrefix("hash1_"))
+	require.Equal(t, 0, c.DeleteByPrefix("hash1_"))
+
+	for _, key := range []string{"hash1_100_100", "hash1_200_200", "hash2_100_100"} {
+		_, ok := c.Get(key)
+		require.False(t, ok)
+
+		// Файлы тоже удалены с диска
+		_, err = os.Stat(fanOutPath(tempDir, key))
+		require.True(t, os.IsNotExist(err))
+	}
+}
+
+func TestLRUCache_clear(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Файл, оставшийся от предыдущего запуска, и чужие файлы
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "key0"), []byte("old"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "notes.txt"), []byte("user"), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(tempDir, "ab"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "ab", "key9"), []byte("user"), 0o644))
+
+	c, err := NewCache(5, tempDir, withTestKeys)
+	require.NoError(t, err)
+	_ = c.Set("key1", []byte("value1"))
+	_ = c.Set("key2", []byte("value2"))
+
+	// Читатель, открывший файл до очистки, дочитывает его до конца
+	f, err := os.Open(fanOutPath(tempDir, "key1"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	require.NoError(t, c.Clear())
+
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, "value1", string(data))
+
+	_, ok := c.Get("key1")
+	require.False(t, ok)
+
+	// Остались только чужие файлы
+	entries, err := os.ReadDir(tempDir)
+	require.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	require.Equal(t, []string{"ab", "notes.txt"}, names)
+	_, err = os.Stat(filepath.Join(tempDir, "ab", "key9"))
+	require.NoError(t, err)
+}
+
+func TestDiskCache_policy(t *testing.T) {
+	c, err := NewCache(2, t.TempDir(), WithPolicy(NewLFUPolicy(2)))
+	require.NoError(t, err)
+
+	_ = c.Set("key1", []byte("value1"))
+	_, _ = c.Get("key1")
+	_, _ = c.Get("key1")
+	_ = c.Set("key2", []byte("value2"))
+	_ = c.Set("key3", []byte("value3"))
+
+	// LFU вытесняет key2, хотя давнее всего обращались к key1
+	_, ok := c.Get("key1")
+	require.True(t, ok)
+	_, ok = c.Get("key2")
+	require.False(t, ok)
+	_, ok = c.Get("key3")
+	require.True(t, ok)
+}
+
+func TestDiskCache_fanOut(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Плоская раскладка предыдущих версий, недописанный временный файл, чужие директория и файл
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "key1"), []byte("value1"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, tmpPrefix+"123"), []byte("partial"), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(tempDir, "originals"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "notes.txt"), []byte("user"), 0o644))
+
+	c, err := NewCache(1, tempDir, withTestKeys)
+	require.NoError(t, err)
+
+	// Файл перенесен в поддиректории и снова доступен из кэша
+	_, err = os.Stat(filepath.Join(tempDir, "key1"))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(fanOutPath(tempDir, "key1"))
+	require.NoError(t, err)
+
+	data, ok := c.Get("key1")
+	require.True(t, ok)
+	require.Equal(t, "value1", string(data))
+
+	// При вытеснении удаляется файл, а поддиректория остается для следующих записей
+	require.NoError(t, c.Set("key2", []byte("value2")))
+	_, err = os.Stat(fanOutPath(tempDir, "key1"))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Dir(fanOutPath(tempDir, "key1")))
+	require.NoError(t, err)
+
+	// Временный файл удален, чужая директория не тронута
+	_, err = os.Stat(filepath.Join(tempDir, tmpPrefix+"123"))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(tempDir, "originals"))
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(tempDir, "notes.txt"))
+	require.NoError(t, err)
+	_, ok = c.Get("notes.txt")
+	require.False(t, ok)
+
+	// Записи переживают перезапуск
+	c, err = NewCache(1, tempDir, withTestKeys)
+	require.NoError(t, err)
+	data, ok = c.Get("key2")
+	require.True(t, ok)
+	require.Equal(t, "value2", string(data))
+}
+
+func TestDiskCache_legacyKeys(t *testing.T) {
+	withLegacyKeys := WithLegacyKeyFormat(func(key string) bool { return strings.HasPrefix(key, "old") })
+	newDir := func() string {
+		// Директория первых версий: записи со старыми ключами, запись, которую можно перенести,
+		// и чужой файл
+		dir := t.TempDir()
+		for _, name := range []string{"old1", "old2", "key1", "notes.txt"} {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644))
+		}
+		return dir
+	}
+	names := func(dir string) []string {
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		names := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			if entry.Type().IsRegular() {
+				names = append(names, entry.Name())
+			}
+		}
+		return names
+	}
+
+	// При запуске записи со старыми ключами удаляются, остальные переносятся в поддиректории
+	tempDir := newDir()
+	c, err := NewCache(5, tempDir, withTestKeys, withLegacyKeys)
+	require.NoError(t, err)
+	require.Equal(t, []string{"notes.txt"}, names(tempDir))
+	require.Equal(t, 1, c.Stats().Disk.Entries)
+	_, ok := c.Get("old1")
+	require.False(t, ok)
+
+	// Очистка тоже удаляет записи со старыми ключами, например появившиеся после запуска
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "old3"), []byte("old3"), 0o644))
+	require.NoError(t, c.Clear())
+	require.Equal(t, []string{"notes.txt"}, names(tempDir))
+
+	// Без формата старых ключей такие файлы не трогаются
+	tempDir = newDir()
+	_, err = NewCache(5, tempDir, withTestKeys)
+	require.NoError(t, err)
+	require.Equal(t, []string{"notes.txt", "old1", "old2"}, names(tempDir))
+}
+
+func TestDiskCache_flush(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	tempDir := t.TempDir()
+
+	c, err := NewCache(3, tempDir, withClock(clock))
+	require.NoError(t, err)
+	require.NoError(t, c.SetWithTTL("key1", []byte("value1"), time.Minute))
+	require.NoError(t, c.Set("key2", []byte("value2")))
+	require.NoError(t, c.Flush())
+
+	// После перезапуска записи сохраняют сроки годности, а индекс не становится записью
+	restarted, err := NewCache(3, tempDir, withClock(clock))
+	require.NoError(t, err)
+	entry, state := restarted.Lookup("key1")
+	require.Equal(t, Fresh, state)
+	require.True(t, now.Add(time.Minute).Equal(entry.ExpiresAt))
+	entry, state = restarted.Lookup("key2")
+	require.Equal(t, Fresh, state)
+	require.True(t, entry.ExpiresAt.IsZero())
+	_, ok := restarted.Get(indexFile)
+	require.False(t, ok)
+
+	now = now.Add(2 * time.Minute)
+	_, state = restarted.Lookup("key1")
+	require.Equal(t, Miss, state)
+}
+
+func TestDiskCache_unindexed(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	tempDir := t.TempDir()
+
+	c, err := NewCache(3, tempDir, withClock(clock))
+	require.NoError(t, err)
+	require.NoError(t, c.Set("key1", []byte("value1")))
+	require.NoError(t, c.Flush())
+	// Запись после Flush не попадает в индекс, как при аварийной остановке
+	require.NoError(t, c.Set("key2", []byte("value2")))
+	modTime := now.Add(-30 * time.Minute)
+	require.NoError(t, os.Chtimes(fanOutPath(tempDir, "key2"), modTime, modTime))
+
+	restarted, err := NewCache(3, tempDir, withClock(clock), WithDefaultTTL(time.Hour))
+	require.NoError(t, err)
+	entry, state := restarted.Lookup("key1")
+	require.Equal(t, Fresh, state)
+	require.True(t, entry.ExpiresAt.IsZero(), "indexed entry keeps its expiry")
+	entry, state = restarted.Lookup("key2")
+	require.Equal(t, Fresh, state)
+	require.True(t, modTime.Add(time.Hour).Equal(entry.ExpiresAt))
+
+	now = now.Add(time.Hour)
+	_, state = restarted.Lookup("key2")
+	require.Equal(t, Miss, state)
+}
+
+func TestDiskCache_stats(t *testing.T) {
+	tempDir := t.TempDir()
+	c, err := NewCache(2, tempDir)
+	require.NoError(t, err)
+
+	require.NoError(t, c.Set("key1", []byte("value1")))
+	require.NoError(t, c.Set("key2", []byte("value22")))
+	require.NoError(t, c.Set("key2", []byte("value2")))
+	// key1 вытесняется
+	require.NoError(t, c.Set("key3", []byte("value3")))
+
+	_, ok := c.Get("key1")
+	require.False(t, ok)
+	_, ok = c.Get("key2")
+	require.True(t, ok)
+	require.Equal(t, Stats{Disk: TierStats{Hits: 1, Misses: 1, Evictions: 1, Entries: 2, Bytes: 12}}, c.Stats())
+
+	// Размер записей, оставшихся от прошлого запуска, тоже учитывается
+	restarted, err := NewCache(2, tempDir)
+	require.NoError(t, err)
+	require.Equal(t, Stats{Disk: TierStats{Entries: 2, Bytes: 12}}, restarted.Stats())
+
+	require.NoError(t, restarted.Clear())
+	require.Equal(t, Stats{Disk: TierStats{}}, restarted.Stats())
+}
@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+type memoryItem struct {
+	key       string
+	data      []byte
+	expiresAt time.Time
+	dirty     bool // данные ещё не записаны на нижний уровень кэша
+}
+
+// memoryCache - LRU-кэш в памяти, ограниченный суммарным размером данных в байтах.
+type memoryCache struct {
+	maxBytes  int64
+	used      int64
+	evictions uint64
+	queue     List
+	items     map[string]*ListItem
+	mu        sync.Mutex
+}
+
+func newMemoryCache(maxBytes int64) *memoryCache {
+	return &memoryCache{
+		maxBytes: maxBytes,
+		queue:    NewList(),
+		items:    make(map[string]*ListItem),
+	}
+}
+
+// set сохраняет данные и возвращает элементы, вытесненные из-за превышения лимита.
+// Данные, которые не помещаются в кэш целиком, не сохраняются: ok будет false.
+func (c *memoryCache) set(key string, entry Entry, dirty bool) (evicted []*memoryItem, ok bool) {
+	data := entry.Data
+	size := int64(len(data))
+	if size > c.maxBytes {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if item, found := c.items[key]; found {
+		mi := item.Value.(*memoryItem)
+		c.used += size - int64(len(mi.data))
+		mi.data = data
+		mi.expiresAt = entry.ExpiresAt
+		mi.dirty = mi.dirty || dirty
+		c.queue.MoveToFront(item)
+	} else {
+		c.items[key] = c.queue.PushFront(&memoryItem{
+			key:       key,
+			data:      data,
+			expiresAt: entry.ExpiresAt,
+			dirty:     dirty,
+		})
+		c.used += size
+	}
+
+	for c.used > c.maxBytes {
+		backItem := c.queue.Back()
+		c.removeItem(backItem)
+		c.evictions++
+		evicted = append(evicted, backItem.Value.(*memoryItem))
+	}
+
+	return evicted, true
+}
+
+func (c *memoryCache) get(key string) (Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if item, found := c.items[key]; found {
+		c.queue.MoveToFront(item)
+		mi := item.Value.(*memoryItem)
+		return Entry{Data: mi.data, ExpiresAt: mi.expiresAt}, true
+	}
+	return Entry{}, false
+}
+
+func (c *memoryCache) remove(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, found := c.items[key]
+	if found {
+		c.removeItem(item)
+	}
+	return found
+}
+
+// removeByPrefix удаляет элементы с ключом, начинающимся с prefix, и возвращает количество
+// удаленных элементов, которых не было на нижнем уровне кэша.
+func (c *memoryCache) removeByPrefix(prefix string) (dirty int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, item := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			if item.Value.(*memoryItem).dirty {
+				dirty++
+			}
+			c.removeItem(item)
+		}
+	}
+	return dirty
+}
+
+// removeItem удаляет элемент из очереди. Вызывается под блокировкой.
+func (c *memoryCache) removeItem(item *ListItem) {
+	mi := item.Value.(*memoryItem)
+	c.queue.Remove(item)
+	delete(c.items, mi.key)
+	c.used -= int64(len(mi.data))
+}
+
+// flush возвращает элементы, которых еще нет на нижнем уровне, и помечает их как записанные.
+func (c *memoryCache) flush() []*memoryItem {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var dirty []*memoryItem
+	for item := c.queue.Front(); item != nil; item = item.Next {
+		mi := item.Value.(*memoryItem)
+		if mi.dirty {
+			dirty = append(dirty, &memoryItem{key: mi.key, data: mi.data, expiresAt: mi.expiresAt, dirty: true})
+			mi.dirty = false
+		}
+	}
+	return dirty
+}
+
+// stats возвращает заполненность кэша и число вытеснений; попадания считает вызывающий.
+func (c *memoryCache) stats() TierStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return TierStats{Evictions: c.evictions, Entries: len(c.items), Bytes: c.used}
+}
+
+func (c *memoryCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queue = NewList()
+	c.items = make(map[string]*ListItem)
+	c.used = 0
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+type negativeItem struct {
+	key       string
+	status    int
+	expiresAt time.Time
+}
+
+// NegativeCache запоминает неудачные ответы источника (например, 404) на короткое время,
+// чтобы повторные запросы не обращались к источнику.
+type NegativeCache struct {
+	ttl        time.Duration
+	maxEntries int
+	// Все записи живут одинаковое время, поэтому порядок добавления совпадает с порядком истечения
+	queue List
+	items map[string]*ListItem
+	now   func() time.Time
+	mu    sync.Mutex
+}
+
+// NewNegativeCache создает кэш ошибок, где каждая запись живет ttl,
+// а записей хранится не больше maxEntries.
+func NewNegativeCache(ttl time.Duration, maxEntries int) *NegativeCache {
+	return &NegativeCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		queue:      NewList(),
+		items:      make(map[string]*ListItem),
+		now:        time.Now,
+	}
+}
+
+// Add запоминает HTTP-статус ошибки для ключа.
+func (c *NegativeCache) Add(key string, status int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if item, found := c.items[key]; found {
+		c.remove(item)
+	}
+	c.items[key] = c.queue.PushBack(&negativeItem{key: key, status: status, expiresAt: c.now().Add(c.ttl)})
+
+	for c.queue.Len() > c.maxEntries {
+		c.remove(c.queue.Front())
+	}
+}
+
+// Get возвращает запомненный статус ошибки, если он еще не истек.
+func (c *NegativeCache) Get(key string) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Попутно удаляем истекшие записи из начала очереди
+	now := c.now()
+	for front := c.queue.Front(); front != nil && !now.Before(front.Value.(*negativeItem).expiresAt); {
+		c.remove(front)
+		front = c.queue.Front()
+	}
+
+	if item, found := c.items[key]; found {
+		return item.Value.(*negativeItem).status, true
+	}
+	return 0, false
+}
+
+// Delete забывает ошибку для ключа.
+func (c *NegativeCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if item, found := c.items[key]; found {
+		c.remove(item)
+	}
+}
+
+func (c *NegativeCache) remove(item *ListItem) {
+	c.queue.Remove(item)
+	delete(c.items, item.Value.(*negativeItem).key)
+}
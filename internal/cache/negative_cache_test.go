@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require" //nolint:depguard
+)
+
+func TestNegativeCache(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	c := NewNegativeCache(time.Minute, 2)
+	c.now = func() time.Time { return now }
+
+	c.Add("hash1", http.StatusNotFound)
+	status, ok := c.Get("hash1")
+	require.True(t, ok)
+	require.Equal(t, http.StatusNotFound, status)
+
+	// Запись истекает через ttl
+	now = now.Add(time.Minute)
+	_, ok = c.Get("hash1")
+	require.False(t, ok)
+
+	// При превышении лимита вытесняется самая старая запись
+	c.Add("hash1", http.StatusNotFound)
+	c.Add("hash2", http.StatusGone)
+	c.Add("hash3", http.StatusUnsupportedMediaType)
+	_, ok = c.Get("hash1")
+	require.False(t, ok)
+	status, ok = c.Get("hash3")
+	require.True(t, ok)
+	require.Equal(t, http.StatusUnsupportedMediaType, status)
+
+	c.Delete("hash2")
+	_, ok = c.Get("hash2")
+	require.False(t, ok)
+}
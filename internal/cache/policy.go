@@ -0,0 +1,130 @@
+package cache
+
+import "fmt"
+
+// Policy решает, какие записи вытеснять из кэша при превышении емкости.
+// Реализации не потокобезопасны: кэш вызывает их под своей блокировкой.
+type Policy interface {
+	// Hit отмечает обращение к ключу, который уже есть в кэше.
+	Hit(key string)
+	// Add добавляет новый ключ и возвращает ключи, которые нужно вытеснить.
+	Add(key string) (evicted []string)
+	// Remove забывает ключ, удаленный из кэша не по решению политики.
+	Remove(key string)
+}
+
+// Названия политик вытеснения для конфигурации.
+const (
+	PolicyLRU = "lru"
+	PolicyLFU = "lfu"
+	Policy2Q  = "2q"
+	PolicyARC = "arc"
+)
+
+// NewPolicy создает политику вытеснения по названию.
+func NewPolicy(name string, capacity int) (Policy, error) {
+	switch name {
+	case PolicyLRU, "":
+		return NewLRUPolicy(capacity), nil
+	case PolicyLFU:
+		return NewLFUPolicy(capacity), nil
+	case Policy2Q:
+		return New2QPolicy(capacity), nil
+	case PolicyARC:
+		return NewARCPolicy(capacity), nil
+	default:
+		return nil, fmt.Errorf("unsupported eviction policy: %s", name)
+	}
+}
+
+// keyList - список ключей с поиском элемента по ключу за O(1).
+type keyList struct {
+	list  List
+	items map[string]*ListItem
+}
+
+func newKeyList() *keyList {
+	return &keyList{
+		list:  NewList(),
+		items: make(map[string]*ListItem),
+	}
+}
+
+func (l *keyList) Len() int {
+	return l.list.Len()
+}
+
+func (l *keyList) Contains(key string) bool {
+	_, found := l.items[key]
+	return found
+}
+
+func (l *keyList) PushFront(key string) {
+	l.items[key] = l.list.PushFront(key)
+}
+
+// MoveToFront перемещает ключ в начало списка и возвращает false, если ключа в списке нет.
+func (l *keyList) MoveToFront(key string) bool {
+	item, found := l.items[key]
+	if found {
+		l.list.MoveToFront(item)
+	}
+	return found
+}
+
+// Remove удаляет ключ и возвращает false, если ключа в списке не было.
+func (l *keyList) Remove(key string) bool {
+	item, found := l.items[key]
+	if found {
+		l.list.Remove(item)
+		delete(l.items, key)
+	}
+	return found
+}
+
+// PopBack удаляет и возвращает ключ из конца списка.
+func (l *keyList) PopBack() (string, bool) {
+	backItem := l.list.Back()
+	if backItem == nil {
+		return "", false
+	}
+	key := backItem.Value.(string)
+	l.list.Remove(backItem)
+	delete(l.items, key)
+	return key, true
+}
+
+// lruPolicy вытесняет запись, к которой дольше всего не обращались.
+type lruPolicy struct {
+	capacity int
+	queue    *keyList
+}
+
+func NewLRUPolicy(capacity int) Policy {
+	return &lruPolicy{
+		capacity: capacity,
+		queue:    newKeyList(),
+	}
+}
+
+func (p *lruPolicy) Hit(key string) {
+	p.queue.MoveToFront(key)
+}
+
+func (p *lruPolicy) Add(key string) []string {
+	if p.queue.MoveToFront(key) {
+		return nil
+	}
+	p.queue.PushFront(key)
+
+	var evicted []string
+	for p.queue.Len() > p.capacity {
+		key, _ := p.queue.PopBack()
+		evicted = append(evicted, key)
+	}
+	return evicted
+}
+
+func (p *lruPolicy) Remove(key string) {
+	p.queue.Remove(key)
+}
@@ -0,0 +1,70 @@
+package cache
+
+// twoQueuePolicy реализует алгоритм 2Q (Johnson, Shasha, 1994).
+//
+// Новые ключи попадают в очередь FIFO recent. Ключи, вытесненные из неё, запоминаются
+// в очереди-призраке ghost (без данных). Повторное обращение к ключу из ghost означает,
+// что ключ популярный, и он попадает в LRU-очередь frequent. Однократные обращения
+// (например, обход каталога краулером) не вытесняют популярные записи из frequent.
+type twoQueuePolicy struct {
+	capacity   int
+	recentSize int // Kin: целевой размер recent
+	ghostSize  int // Kout: размер ghost
+	recent     *keyList
+	ghost      *keyList
+	frequent   *keyList
+}
+
+func New2QPolicy(capacity int) Policy {
+	return &twoQueuePolicy{
+		capacity:   capacity,
+		recentSize: max(capacity/4, 1),
+		ghostSize:  max(capacity/2, 1),
+		recent:     newKeyList(),
+		ghost:      newKeyList(),
+		frequent:   newKeyList(),
+	}
+}
+
+func (p *twoQueuePolicy) Hit(key string) {
+	// Обращения к ключам из recent не меняют порядок: это защищает от коротких всплесков
+	p.frequent.MoveToFront(key)
+}
+
+func (p *twoQueuePolicy) Add(key string) []string {
+	if p.recent.Contains(key) || p.frequent.MoveToFront(key) {
+		return nil
+	}
+
+	var evicted []string
+	for p.recent.Len()+p.frequent.Len() >= p.capacity && p.recent.Len()+p.frequent.Len() > 0 {
+		evicted = append(evicted, p.reclaim())
+	}
+
+	if p.ghost.Remove(key) {
+		p.frequent.PushFront(key)
+	} else {
+		p.recent.PushFront(key)
+	}
+	return evicted
+}
+
+func (p *twoQueuePolicy) Remove(key string) {
+	if !p.recent.Remove(key) && !p.frequent.Remove(key) {
+		p.ghost.Remove(key)
+	}
+}
+
+// reclaim освобождает одно место и возвращает вытесненный ключ.
+func (p *twoQueuePolicy) reclaim() string {
+	if p.recent.Len() > p.recentSize || p.frequent.Len() == 0 {
+		key, _ := p.recent.PopBack()
+		p.ghost.PushFront(key)
+		if p.ghost.Len() > p.ghostSize {
+			p.ghost.PopBack()
+		}
+		return key
+	}
+	key, _ := p.frequent.PopBack()
+	return key
+}
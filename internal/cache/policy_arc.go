@@ -0,0 +1,103 @@
+package cache
+
+// arcPolicy реализует алгоритм Adaptive Replacement Cache (Megiddo, Modha, 2003).
+//
+// Записи делятся на встреченные однажды (t1) и повторно (t2). Для каждой из частей хранится
+// очередь-призрак вытесненных ключей (b1 и b2). Попадания в призраки сдвигают целевой размер t1,
+// поэтому политика сама подстраивается между LRU и LFU под характер нагрузки.
+type arcPolicy struct {
+	capacity int
+	target   int // p: целевой размер t1
+	t1, t2   *keyList
+	b1, b2   *keyList
+}
+
+func NewARCPolicy(capacity int) Policy {
+	return &arcPolicy{
+		capacity: capacity,
+		t1:       newKeyList(),
+		t2:       newKeyList(),
+		b1:       newKeyList(),
+		b2:       newKeyList(),
+	}
+}
+
+func (p *arcPolicy) Hit(key string) {
+	if p.t1.Remove(key) {
+		p.t2.PushFront(key)
+		return
+	}
+	p.t2.MoveToFront(key)
+}
+
+func (p *arcPolicy) Add(key string) []string {
+	if p.t1.Contains(key) || p.t2.Contains(key) {
+		p.Hit(key)
+		return nil
+	}
+
+	var evicted []string
+	switch {
+	case p.b1.Contains(key):
+		// Недавно вытесненный из t1 ключ снова нужен - увеличиваем долю t1
+		p.target = min(p.capacity, p.target+max(p.b2.Len()/p.b1.Len(), 1))
+		evicted = p.replace(false)
+		p.b1.Remove(key)
+		p.t2.PushFront(key)
+		return evicted
+
+	case p.b2.Contains(key):
+		// Недавно вытесненный из t2 ключ снова нужен - уменьшаем долю t1
+		p.target = max(0, p.target-max(p.b1.Len()/p.b2.Len(), 1))
+		evicted = p.replace(true)
+		p.b2.Remove(key)
+		p.t2.PushFront(key)
+		return evicted
+	}
+
+	switch l1 := p.t1.Len() + p.b1.Len(); {
+	case l1 >= p.capacity:
+		if p.t1.Len() < p.capacity {
+			p.b1.PopBack()
+			evicted = p.replace(false)
+		} else {
+			// b1 пуст, вытесняем из t1 без запоминания в призраке
+			key, _ := p.t1.PopBack()
+			evicted = append(evicted, key)
+		}
+	case l1+p.t2.Len()+p.b2.Len() >= p.capacity:
+		if l1+p.t2.Len()+p.b2.Len() >= 2*p.capacity {
+			p.b2.PopBack()
+		}
+		evicted = p.replace(false)
+	}
+
+	p.t1.PushFront(key)
+	return evicted
+}
+
+func (p *arcPolicy) Remove(key string) {
+	for _, l := range []*keyList{p.t1, p.t2, p.b1, p.b2} {
+		if l.Remove(key) {
+			return
+		}
+	}
+}
+
+// replace вытесняет одну запись из t1 или t2, если кэш заполнен, и запоминает её в призраке.
+func (p *arcPolicy) replace(inB2 bool) []string {
+	if p.t1.Len()+p.t2.Len() < p.capacity {
+		return nil
+	}
+	if p.t1.Len() > 0 && (p.t1.Len() > p.target || (inB2 && p.t1.Len() == p.target)) {
+		key, _ := p.t1.PopBack()
+		p.b1.PushFront(key)
+		return []string{key}
+	}
+	key, ok := p.t2.PopBack()
+	if !ok {
+		return nil
+	}
+	p.b2.PushFront(key)
+	return []string{key}
+}
@@ -0,0 +1,88 @@
+package cache
+
+type lfuEntry struct {
+	key  string
+	freq int
+}
+
+// lfuPolicy вытесняет запись с наименьшим числом обращений, а среди равных - самую давнюю.
+// Ключи хранятся в списках по частоте обращений, поэтому все операции выполняются за O(1).
+type lfuPolicy struct {
+	capacity int
+	minFreq  int
+	items    map[string]*ListItem
+	freqs    map[int]List
+}
+
+func NewLFUPolicy(capacity int) Policy {
+	return &lfuPolicy{
+		capacity: capacity,
+		items:    make(map[string]*ListItem, capacity),
+		freqs:    make(map[int]List),
+	}
+}
+
+func (p *lfuPolicy) Hit(key string) {
+	item, found := p.items[key]
+	if !found {
+		return
+	}
+	entry := item.Value.(*lfuEntry)
+	p.unlink(item)
+	if entry.freq == p.minFreq && p.freqs[entry.freq] == nil {
+		p.minFreq++
+	}
+	entry.freq++
+	p.items[key] = p.bucket(entry.freq).PushFront(entry)
+}
+
+func (p *lfuPolicy) Add(key string) []string {
+	if _, found := p.items[key]; found {
+		p.Hit(key)
+		return nil
+	}
+
+	var evicted []string
+	for len(p.items) >= p.capacity && len(p.items) > 0 {
+		victims := p.freqs[p.minFreq]
+		for victims == nil {
+			p.minFreq++
+			victims = p.freqs[p.minFreq]
+		}
+		backItem := victims.Back()
+		entry := backItem.Value.(*lfuEntry)
+		p.unlink(backItem)
+		delete(p.items, entry.key)
+		evicted = append(evicted, entry.key)
+	}
+
+	p.items[key] = p.bucket(1).PushFront(&lfuEntry{key: key, freq: 1})
+	p.minFreq = 1
+	return evicted
+}
+
+func (p *lfuPolicy) Remove(key string) {
+	if item, found := p.items[key]; found {
+		p.unlink(item)
+		delete(p.items, key)
+	}
+}
+
+func (p *lfuPolicy) bucket(freq int) List {
+	l, found := p.freqs[freq]
+	if !found {
+		l = NewList()
+		p.freqs[freq] = l
+	}
+	return l
+}
+
+// unlink удаляет элемент из списка его частоты; пустые списки удаляются.
+func (p *lfuPolicy) unlink(item *ListItem) {
+	freq := item.Value.(*lfuEntry).freq
+	l := p.freqs[freq]
+	l.Remove(item)
+	if l.Len() == 0 {
+		delete(p.freqs, freq)
+	}
+}
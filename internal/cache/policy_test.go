@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require" //nolint:depguard
+)
+
+var policyNames = []string{PolicyLRU, PolicyLFU, Policy2Q, PolicyARC}
+
+func TestPolicies_capacity(t *testing.T) {
+	for _, name := range policyNames {
+		t.Run(name, func(t *testing.T) {
+			p, err := NewPolicy(name, 3)
+			require.NoError(t, err)
+
+			resident := make(map[string]bool)
+			for i := 0; i < 100; i++ {
+				key := string(rune('a' + i%7))
+				if resident[key] {
+					p.Hit(key)
+					continue
+				}
+				resident[key] = true
+				for _, evicted := range p.Add(key) {
+					require.True(t, resident[evicted], "evicted key %s is not resident", evicted)
+					delete(resident, evicted)
+				}
+				require.LessOrEqual(t, len(resident), 3)
+			}
+
+			// После явного удаления ключ не должен вытесняться повторно
+			for key := range resident {
+				p.Remove(key)
+				delete(resident, key)
+				break
+			}
+			for i := 0; i < 10; i++ {
+				key := string(rune('A' + i))
+				resident[key] = true
+				for _, evicted := range p.Add(key) {
+					require.True(t, resident[evicted], "evicted key %s is not resident", evicted)
+					delete(resident, evicted)
+				}
+				require.LessOrEqual(t, len(resident), 3)
+			}
+		})
+	}
+}
+
+func TestPolicies_unknown(t *testing.T) {
+	_, err := NewPolicy("fifo", 3)
+	require.Error(t, err)
+}
+
+func TestLFUPolicy_keepsFrequent(t *testing.T) {
+	p := NewLFUPolicy(2)
+	require.Empty(t, p.Add("key1"))
+	p.Hit("key1")
+	require.Empty(t, p.Add("key2"))
+
+	// key2 использовался реже, чем key1
+	require.Equal(t, []string{"key2"}, p.Add("key3"))
+	require.Equal(t, []string{"key3"}, p.Add("key4"))
+}
+
+func TestScanResistantPolicies(t *testing.T) {
+	for _, name := range []string{Policy2Q, PolicyARC} {
+		t.Run(name, func(t *testing.T) {
+			p, err := NewPolicy(name, 8)
+			require.NoError(t, err)
+
+			// Два популярных ключа, к которым обращаются повторно, пока кэш заполняется
+			trace := []string{"hot1", "hot2", "hot1", "hot2"}
+			for i := 1; i <= 8; i++ {
+				trace = append(trace, fmt.Sprintf("c%d", i))
+			}
+			trace = append(trace, "hot1", "hot2")
+			// Обход каталога: множество однократных обращений
+			for i := 1; i <= 16; i++ {
+				trace = append(trace, fmt.Sprintf("s%d", i))
+			}
+			resident := replay(p, trace).resident
+
+			require.True(t, resident["hot1"])
+			require.True(t, resident["hot2"])
+		})
+	}
+}
+
+// Трассы в testdata/*.log содержат по одному пути запроса на строку. Файл synthetic_storefront.log -
+// синтетическая трасса, а не выгрузка реального журнала: сгенерированные обращения к популярным
+// товарам вперемешку с обходами каталога краулером. Для сравнения политик на реальной нагрузке
+// достаточно положить рядом выгрузку путей из журнала доступа.
+func TestPolicies_syntheticTraceReplay(t *testing.T) {
+	const capacity = 100
+
+	files, err := filepath.Glob(filepath.Join("testdata", "*.log"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	for _, file := range files {
+		trace := readTrace(t, file)
+
+		hitRates := make(map[string]float64, len(policyNames))
+		for _, name := range policyNames {
+			p, err := NewPolicy(name, capacity)
+			require.NoError(t, err)
+
+			res := replay(p, trace)
+			require.LessOrEqual(t, len(res.resident), capacity)
+			hitRates[name] = res.hitRate()
+			t.Logf("%s %-4s hit rate %.2f%%", filepath.Base(file), name, 100*hitRates[name])
+		}
+
+		if filepath.Base(file) == "synthetic_storefront.log" {
+			// Обход каталога вымывает популярные записи из LRU, но не из 2Q и ARC
+			require.Greater(t, hitRates[Policy2Q], hitRates[PolicyLRU])
+			require.Greater(t, hitRates[PolicyARC], hitRates[PolicyLRU])
+		}
+	}
+}
+
+type replayResult struct {
+	hits, misses int
+	resident     map[string]bool
+}
+
+func (r replayResult) hitRate() float64 {
+	return float64(r.hits) / float64(r.hits+r.misses)
+}
+
+// replay проигрывает трассу обращений так же, как их обрабатывает дисковый кэш:
+// промах приводит к добавлению ключа, попадание - к отметке обращения.
+func replay(p Policy, trace []string) replayResult {
+	res := replayResult{resident: make(map[string]bool)}
+	for _, key := range trace {
+		if res.resident[key] {
+			res.hits++
+			p.Hit(key)
+			continue
+		}
+		res.misses++
+		res.resident[key] = true
+		for _, evicted := range p.Add(key) {
+			delete(res.resident, evicted)
+		}
+	}
+	return res
+}
+
+func readTrace(t *testing.T, path string) []string {
+	t.Helper()
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var trace []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			trace = append(trace, line)
+		}
+	}
+	require.NoError(t, scanner.Err())
+	return trace
+}
@@ -0,0 +1,182 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type tieredCache struct {
+	hot  *memoryCache
+	cold Cache
+	opts options
+
+	// Удаление ждет записи вытесненных элементов на диск, которые уже начались, и увеличивает
+	// generation. Элементы, вытесненные до удаления, на диск уже не записываются, иначе
+	// удаленные данные вернулись бы в кэш.
+	mu         sync.RWMutex
+	generation uint64
+
+	memoryHits   atomic.Uint64
+	memoryMisses atomic.Uint64
+}
+
+// NewTieredCache создает двухуровневый кэш, который держит недавно отданные варианты в памяти:
+// горячий уровень в памяти размером maxBytes и холодный уровень cold (как правило, дисковый кэш).
+//
+// Новые данные попадают в память и записываются на нижний уровень только при вытеснении.
+// Попадание в холодный уровень поднимает данные в память.
+func NewTieredCache(maxBytes int64, cold Cache, opts ...Option) Cache {
+	return &tieredCache{
+		hot:  newMemoryCache(maxBytes),
+		cold: cold,
+		opts: newOptions(opts),
+	}
+}
+
+func (c *tieredCache) Set(key string, data []byte) error {
+	return c.set(key, Entry{Data: data})
+}
+
+func (c *tieredCache) SetWithTTL(key string, data []byte, ttl time.Duration) error {
+	return c.set(key, Entry{Data: data, ExpiresAt: c.opts.expiresAt(ttl)})
+}
+
+func (c *tieredCache) set(key string, entry Entry) error {
+	generation := c.currentGeneration()
+	evicted, ok := c.hot.set(key, entry, true)
+	if !ok {
+		// Слишком большие данные сразу уходят на диск, а прежнее значение в памяти удаляется,
+		// иначе оно отдавалось бы вместо нового
+		c.hot.remove(key)
+		return c.setCold(key, entry)
+	}
+	return c.demote(generation, evicted)
+}
+
+func (c *tieredCache) Get(key string) ([]byte, bool) {
+	entry, state := c.Lookup(key)
+	if state == Miss {
+		return nil, false
+	}
+	return entry.Data, true
+}
+
+func (c *tieredCache) Lookup(key string) (Entry, State) {
+	if entry, ok := c.hot.get(key); ok {
+		state := c.opts.state(entry.ExpiresAt)
+		if state != Miss {
+			c.memoryHits.Add(1)
+			return entry, state
+		}
+		c.hot.remove(key)
+	}
+	c.memoryMisses.Add(1)
+
+	// Поколение читается до обращения к диску: если запись удалят после чтения с диска,
+	// она не должна вернуться в память
+	generation := c.currentGeneration()
+	entry, state := c.cold.Lookup(key)
+	if state == Miss {
+		return Entry{}, Miss
+	}
+	if evicted, ok := c.promote(generation, key, entry); ok {
+		_ = c.demote(generation, evicted)
+	}
+	return entry, state
+}
+
+func (c *tieredCache) Delete(key string) bool {
+	c.beginPurge()
+	defer c.mu.Unlock()
+	inMemory := c.hot.remove(key)
+	onDisk := c.cold.Delete(key)
+	return inMemory || onDisk
+}
+
+// DeleteByPrefix удаляет записи с обоих уровней. Записи, которые есть и в памяти, и на диске,
+// считаются один раз.
+func (c *tieredCache) DeleteByPrefix(prefix string) int {
+	c.beginPurge()
+	defer c.mu.Unlock()
+	onlyInMemory := c.hot.removeByPrefix(prefix)
+	return onlyInMemory + c.cold.DeleteByPrefix(prefix)
+}
+
+func (c *tieredCache) Clear() error {
+	c.beginPurge()
+	defer c.mu.Unlock()
+	c.hot.clear()
+	return c.cold.Clear()
+}
+
+// Flush записывает на диск все данные, которые пока есть только в памяти.
+func (c *tieredCache) Flush() error {
+	generation := c.currentGeneration()
+	return errors.Join(c.demote(generation, c.hot.flush()), c.cold.Flush())
+}
+
+// Stats возвращает статистику памяти и нижнего уровня. Попадания и промахи нижнего уровня
+// считает он сам, поэтому обращения мимо памяти учитываются там же.
+func (c *tieredCache) Stats() Stats {
+	memory := c.hot.stats()
+	memory.Hits = c.memoryHits.Load()
+	memory.Misses = c.memoryMisses.Load()
+	return Stats{Memory: memory, Disk: c.cold.Stats().Disk}
+}
+
+// beginPurge дожидается записи вытесненных элементов и запрещает записывать на диск элементы,
+// вытесненные до удаления. Блокировку снимает вызывающий.
+func (c *tieredCache) beginPurge() {
+	c.mu.Lock()
+	c.generation++
+}
+
+func (c *tieredCache) currentGeneration() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.generation
+}
+
+// promote поднимает прочитанные с диска данные в память, если с момента чтения ничего не удаляли.
+// На диске данные уже есть, поэтому элемент не помечается как изменённый.
+func (c *tieredCache) promote(generation uint64, key string, entry Entry) ([]*memoryItem, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if generation != c.generation {
+		return nil, false
+	}
+	return c.hot.set(key, entry, false)
+}
+
+// demote записывает на диск вытесненные из памяти элементы, которых там ещё нет. Элементы,
+// вытесненные до удаления записей (generation изменилась), отбрасываются: среди них могут быть
+// удаленные, а отличить их от остальных уже нельзя.
+func (c *tieredCache) demote(generation uint64, evicted []*memoryItem) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if generation != c.generation {
+		return nil
+	}
+
+	var firstErr error
+	for _, item := range evicted {
+		if !item.dirty {
+			continue
+		}
+		err := c.setCold(item.key, Entry{Data: item.data, ExpiresAt: item.expiresAt})
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// setCold записывает запись на диск, сохраняя оставшийся срок годности.
+func (c *tieredCache) setCold(key string, entry Entry) error {
+	if entry.ExpiresAt.IsZero() {
+		return c.cold.Set(key, entry.Data)
+	}
+	return c.cold.SetWithTTL(key, entry.Data, entry.ExpiresAt.Sub(c.opts.now()))
+}
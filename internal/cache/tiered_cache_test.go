@@ -0,0 +1,245 @@
+package cache
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require" //nolint:depguard
+)
+
+func TestTieredCache_memoryHit(t *testing.T) {
+	tempDir := t.TempDir()
+	disk, err := NewCache(10, tempDir)
+	require.NoError(t, err)
+
+	c := NewTieredCache(1024, disk)
+	require.NoError(t, c.Set("key1", []byte("value1")))
+
+	// Данные лежат только в памяти, на диск ещё ничего не записано
+	_, err = os.Stat(fanOutPath(tempDir, "key1"))
+	require.True(t, os.IsNotExist(err))
+
+	data, ok := c.Get("key1")
+	require.True(t, ok)
+	require.Equal(t, "value1", string(data))
+	require.Equal(t, Stats{Memory: TierStats{Hits: 1, Entries: 1, Bytes: 6}}, c.Stats())
+}
+
+func TestTieredCache_demoteAndPromote(t *testing.T) {
+	tempDir := t.TempDir()
+	disk, err := NewCache(10, tempDir)
+	require.NoError(t, err)
+
+	// В память помещаются только два значения по 6 байт
+	c := NewTieredCache(12, disk)
+	require.NoError(t, c.Set("key1", []byte("value1")))
+	require.NoError(t, c.Set("key2", []byte("value2")))
+	require.NoError(t, c.Set("key3", []byte("value3")))
+
+	// key1 вытеснен из памяти и записан на диск
+	_, err = os.Stat(fanOutPath(tempDir, "key1"))
+	require.NoError(t, err)
+
+	data, ok := c.Get("key1")
+	require.True(t, ok)
+	require.Equal(t, "value1", string(data))
+	// Вытеснены key1 при записи key3 и key2 при подъеме key1, оба лежат на диске
+	require.Equal(t, TierStats{Misses: 1, Evictions: 2, Entries: 2, Bytes: 12}, c.Stats().Memory)
+	require.Equal(t, TierStats{Hits: 1, Entries: 2, Bytes: 12}, c.Stats().Disk)
+
+	// После подъема в память key1 отдается без обращения к диску
+	_, ok = c.Get("key1")
+	require.True(t, ok)
+	require.Equal(t, TierStats{Hits: 1, Misses: 1, Evictions: 2, Entries: 2, Bytes: 12}, c.Stats().Memory)
+	require.Equal(t, TierStats{Hits: 1, Entries: 2, Bytes: 12}, c.Stats().Disk)
+
+	// key2 был вытеснен при подъеме key1 и тоже оказался на диске
+	_, err = os.Stat(fanOutPath(tempDir, "key2"))
+	require.NoError(t, err)
+
+	_, ok = c.Get("missing")
+	require.False(t, ok)
+	require.Equal(t, TierStats{Hits: 1, Misses: 1, Entries: 2, Bytes: 12}, c.Stats().Disk)
+}
+
+func TestTieredCache_largeValueGoesToDisk(t *testing.T) {
+	tempDir := t.TempDir()
+	disk, err := NewCache(10, tempDir)
+	require.NoError(t, err)
+
+	c := NewTieredCache(4, disk)
+	require.NoError(t, c.Set("key1", []byte("value1")))
+
+	_, err = os.Stat(fanOutPath(tempDir, "key1"))
+	require.NoError(t, err)
+
+	data, ok := c.Get("key1")
+	require.True(t, ok)
+	require.Equal(t, "value1", string(data))
+}
+
+func TestTieredCache_largeValueReplacesMemory(t *testing.T) {
+	disk, err := NewCache(10, t.TempDir())
+	require.NoError(t, err)
+
+	c := NewTieredCache(8, disk)
+	require.NoError(t, c.Set("key1", []byte("small")))
+	require.NoError(t, c.Set("key1", []byte("large value")))
+
+	data, ok := c.Get("key1")
+	require.True(t, ok)
+	require.Equal(t, "large value", string(data))
+	require.Zero(t, c.Stats().Memory.Entries)
+}
+
+func TestTieredCache_clear(t *testing.T) {
+	disk, err := NewCache(10, t.TempDir())
+	require.NoError(t, err)
+
+	c := NewTieredCache(1024, disk)
+	require.NoError(t, c.Set("key1", []byte("value1")))
+	require.NoError(t, c.Clear())
+
+	_, ok := c.Get("key1")
+	require.False(t, ok)
+}
+
+func TestTieredCache_ttl(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	disk, err := NewCache(3, t.TempDir(), WithStaleWindow(time.Minute), withClock(clock))
+	require.NoError(t, err)
+	c := NewTieredCache(6, disk, WithStaleWindow(time.Minute), withClock(clock))
+
+	require.NoError(t, c.SetWithTTL("key1", []byte("value1"), time.Minute))
+	// key1 вытесняется на диск вместе с оставшимся сроком годности
+	require.NoError(t, c.SetWithTTL("key2", []byte("value2"), time.Hour))
+
+	now = now.Add(30 * time.Second)
+	entry, state := c.Lookup("key1")
+	require.Equal(t, Fresh, state)
+	require.Equal(t, now.Add(30*time.Second), entry.ExpiresAt)
+
+	now = now.Add(time.Minute)
+	_, state = c.Lookup("key1")
+	require.Equal(t, Stale, state)
+
+	now = now.Add(time.Minute)
+	_, state = c.Lookup("key1")
+	require.Equal(t, Miss, state)
+}
+
+func TestTieredCache_deleteByPrefix(t *testing.T) {
+	disk, err := NewCache(10, t.TempDir())
+	require.NoError(t, err)
+
+	c := NewTieredCache(12, disk)
+	require.NoError(t, c.Set("hash1_1", []byte("value1")))
+	require.NoError(t, c.Set("hash1_2", []byte("value2")))
+	// hash1_1 вытесняется на диск, hash1_2 остается только в памяти
+	require.NoError(t, c.Set("hash2_1", []byte("value3")))
+
+	require.Equal(t, 2, c.DeleteByPrefix("hash1_"))
+	_, ok := c.Get("hash1_1")
+	require.False(t, ok)
+	_, ok = c.Get("hash1_2")
+	require.False(t, ok)
+
+	require.True(t, c.Delete("hash2_1"))
+	_, ok = c.Get("hash2_1")
+	require.False(t, ok)
+}
+
+func TestTieredCache_flush(t *testing.T) {
+	tempDir := t.TempDir()
+	disk, err := NewCache(10, tempDir)
+	require.NoError(t, err)
+
+	c := NewTieredCache(1024, disk)
+	require.NoError(t, c.SetWithTTL("key1", []byte("value1"), time.Hour))
+	require.NoError(t, c.Flush())
+
+	// Запись из памяти оказалась на диске и переживает перезапуск
+	restarted, err := NewCache(10, tempDir)
+	require.NoError(t, err)
+	entry, state := restarted.Lookup("key1")
+	require.Equal(t, Fresh, state)
+	require.Equal(t, "value1", string(entry.Data))
+	require.False(t, entry.ExpiresAt.IsZero())
+}
+
+// blockingCache задерживает запись на нижний уровень, пока не закрыт канал release.
+type blockingCache struct {
+	Cache
+	started chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingCache) Set(key string, data []byte) error {
+	close(c.started)
+	<-c.release
+	return c.Cache.Set(key, data)
+}
+
+func TestTieredCache_deleteWhileDemoting(t *testing.T) {
+	disk, err := NewCache(10, t.TempDir())
+	require.NoError(t, err)
+	cold := &blockingCache{Cache: disk, started: make(chan struct{}), release: make(chan struct{})}
+
+	// В память помещается одно значение, key1 вытесняется при записи key2
+	c := NewTieredCache(6, cold).(*tieredCache)
+	require.NoError(t, c.Set("key1", []byte("value1")))
+	setDone := make(chan error)
+	go func() { setDone <- c.Set("key2", []byte("value2")) }()
+	<-cold.started
+
+	// Удаление дожидается записи вытесненного key1 и удаляет его с диска
+	deleted := make(chan bool)
+	go func() { deleted <- c.Delete("key1") }()
+	time.Sleep(10 * time.Millisecond)
+	close(cold.release)
+	require.NoError(t, <-setDone)
+	require.True(t, <-deleted)
+	_, ok := c.Get("key1")
+	require.False(t, ok)
+
+	// Элементы, вытесненные до удаления, на диск не записываются
+	generation := c.currentGeneration()
+	evicted, ok := c.hot.set("key3", Entry{Data: []byte("value3")}, true)
+	require.True(t, ok)
+	require.Len(t, evicted, 1)
+	require.Zero(t, c.DeleteByPrefix("key2"))
+	require.NoError(t, c.demote(generation, evicted))
+	_, ok = c.Get("key2")
+	require.False(t, ok)
+}
+
+// purgingCache удаляет запись из tiered сразу после чтения с диска, как параллельный запрос на удаление.
+type purgingCache struct {
+	Cache
+	tiered Cache
+}
+
+func (c *purgingCache) Lookup(key string) (Entry, State) {
+	entry, state := c.Cache.Lookup(key)
+	c.tiered.Delete(key)
+	return entry, state
+}
+
+func TestTieredCache_deleteWhilePromoting(t *testing.T) {
+	disk, err := NewCache(10, t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, disk.Set("key1", []byte("value1")))
+	cold := &purgingCache{Cache: disk}
+	c := NewTieredCache(1024, cold)
+	cold.tiered = c
+
+	// Запись, удаленная после чтения с диска, не поднимается в память
+	_, ok := c.Get("key1")
+	require.True(t, ok)
+	require.Zero(t, c.Stats().Memory.Entries)
+	_, state := disk.Lookup("key1")
+	require.Equal(t, Miss, state)
+}
@@ -0,0 +1,49 @@
+package image
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CacheTTL вычисляет срок годности ответа по заголовкам Cache-Control (s-maxage, max-age) и Expires.
+// no-store и no-cache означают, что ответ устарел сразу и при следующем обращении его нужно обновить.
+// Если источник не указал срок годности, ok будет false.
+func CacheTTL(header http.Header, now time.Time) (ttl time.Duration, ok bool) {
+	var maxAge, sMaxAge string
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache":
+			return 0, true
+		case "max-age":
+			maxAge = value
+		case "s-maxage":
+			sMaxAge = value
+		}
+	}
+
+	// s-maxage предназначен для разделяемых кэшей и имеет приоритет над max-age
+	for _, value := range []string{sMaxAge, maxAge} {
+		if value == "" {
+			continue
+		}
+		seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+		if err != nil || seconds < 0 {
+			continue
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if expires := header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			// Некорректное значение Expires означает, что ответ уже устарел
+			return 0, true
+		}
+		return t.Sub(now), true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,38 @@
+package image
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require" //nolint:depguard
+)
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	expires := now.Add(time.Hour).Format(http.TimeFormat)
+
+	for _, tc := range []struct {
+		name   string
+		header http.Header
+		ttl    time.Duration
+		ok     bool
+	}{
+		{"max-age", http.Header{"Cache-Control": {"public, max-age=600"}}, 10 * time.Minute, true},
+		{"quoted max-age", http.Header{"Cache-Control": {`max-age="60"`}}, time.Minute, true},
+		{"s-maxage wins", http.Header{"Cache-Control": {"max-age=600, s-maxage=60"}}, time.Minute, true},
+		{"no-store", http.Header{"Cache-Control": {"no-store, max-age=600"}}, 0, true},
+		{"no-cache", http.Header{"Cache-Control": {"No-Cache"}}, 0, true},
+		{"max-age over expires", http.Header{"Cache-Control": {"max-age=60"}, "Expires": {expires}}, time.Minute, true},
+		{"bad max-age", http.Header{"Cache-Control": {"max-age=abc"}, "Expires": {expires}}, time.Hour, true},
+		{"expires", http.Header{"Expires": {expires}}, time.Hour, true},
+		{"bad expires", http.Header{"Expires": {"0"}}, 0, true},
+		{"none", http.Header{"Cache-Control": {"public"}}, 0, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ttl, ok := CacheTTL(tc.header, now)
+			require.Equal(t, tc.ok, ok)
+			require.Equal(t, tc.ttl, ttl)
+		})
+	}
+}
@@ -3,82 +3,145 @@ package image
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"image"
 	"image/gif"
 	"image/jpeg"
 	"image/png"
-	"io"
-	"net/http"
-	"time"
+	"math"
 
 	"github.com/disintegration/imaging" //nolint:depguard
+	"go.uber.org/zap"
+	"resizer/logger" //nolint:depguard
 )
 
-func DownloadImage(url string, headers http.Header) ([]byte, error) {
-	// Создаем контекст с таймаутом 10 секунд
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// ErrNotImage означает, что источник вернул данные, которые не удалось декодировать как изображение.
+var ErrNotImage = errors.New("not an image")
 
-	// Создаем новый HTTP-запрос с контекстом
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+// Dimensions возвращает размеры изображения, читая только его заголовок.
+func Dimensions(data []byte) (width, height int, err error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
 	if err != nil {
-		return nil, err
+		return 0, 0, fmt.Errorf("%w: %w", ErrNotImage, err)
 	}
+	return cfg.Width, cfg.Height, nil
+}
 
-	// Копируем заголовки из исходного запроса
-	req.Header = headers
-
-	// Выполняем запрос
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// Decode декодирует изображение и возвращает его вместе с форматом.
+// Подробности пишутся в логгер запроса из ctx.
+func Decode(ctx context.Context, data []byte) (image.Image, string, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
-		return nil, err
+		logger.FromContext(ctx).Debug("Failed to decode image", zap.Int("bytes", len(data)), zap.Error(err))
+		return nil, "", fmt.Errorf("%w: %w", ErrNotImage, err)
 	}
+	logger.FromContext(ctx).Debug("Decoded image",
+		zap.String("format", format),
+		zap.Int("width", img.Bounds().Dx()),
+		zap.Int("height", img.Bounds().Dy()),
+		zap.Int("bytes", len(data)),
+	)
+	return img, format, nil
+}
 
-	// Гарантируем закрытие тела ответа
-	defer func() {
-		_ = resp.Body.Close()
-	}()
+// Режимы масштабирования.
+const (
+	// ModeResize растягивает изображение точно до заданных размеров.
+	ModeResize = "resize"
+	// ModeFit вписывает изображение в заданные размеры с сохранением пропорций.
+	ModeFit = "fit"
+	// ModeFill заполняет заданные размеры с сохранением пропорций, обрезая лишнее со стороны,
+	// противоположной gravity.
+	ModeFill = "fill"
+)
 
-	// Проверяем статус ответа
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to download image: status code %d", resp.StatusCode)
-	}
+// gravities - точки привязки обрезки в режиме ModeFill.
+var gravities = map[string]imaging.Anchor{
+	"center":    imaging.Center,
+	"north":     imaging.Top,
+	"south":     imaging.Bottom,
+	"east":      imaging.Right,
+	"west":      imaging.Left,
+	"northeast": imaging.TopRight,
+	"northwest": imaging.TopLeft,
+	"southeast": imaging.BottomRight,
+	"southwest": imaging.BottomLeft,
+}
 
-	// Читаем тело ответа
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+// Resize масштабирует изображение до размеров width x height в режиме mode (пустой - ModeResize).
+// gravity задает, какую часть изображения сохранить в режиме ModeFill (пустой - center).
+// Нулевой размер вычисляется по пропорциям изображения, а если оба размера нулевые,
+// изображение остается исходного размера.
+func Resize(ctx context.Context, img image.Image, width, height int, mode, gravity string) image.Image {
+	var resized image.Image
+	switch {
+	case width == 0 && height == 0:
+		resized = img
+	case width == 0 || height == 0:
+		// Вписывать и обрезать не во что - сохраняем пропорции при любом режиме
+		resized = imaging.Resize(img, width, height, imaging.Lanczos)
+	case mode == ModeFit:
+		resized = imaging.Fit(img, width, height, imaging.Lanczos)
+	case mode == ModeFill:
+		anchor, ok := gravities[gravity]
+		if !ok {
+			anchor = imaging.Center
+		}
+		resized = imaging.Fill(img, width, height, anchor, imaging.Lanczos)
+	default:
+		resized = imaging.Resize(img, width, height, imaging.Lanczos)
 	}
-
-	return data, nil
+	logger.FromContext(ctx).Debug("Resized image",
+		zap.String("mode", mode),
+		zap.Int("fromWidth", img.Bounds().Dx()),
+		zap.Int("fromHeight", img.Bounds().Dy()),
+		zap.Int("width", resized.Bounds().Dx()),
+		zap.Int("height", resized.Bounds().Dy()),
+	)
+	return resized
 }
 
-func ResizeImage(data []byte, width, height int) ([]byte, string, error) {
-	// Декодируем изображение
-	img, format, err := image.Decode(bytes.NewReader(data))
-	if err != nil {
-		return nil, "", err
+// Size возвращает размеры, которые получатся после Resize изображения srcWidth x srcHeight.
+// В режиме ModeFit это верхняя граница: изображение может оказаться меньше по одной из сторон.
+func Size(srcWidth, srcHeight, width, height int) (int, int) {
+	switch {
+	case width == 0 && height == 0:
+		return srcWidth, srcHeight
+	case srcWidth == 0 || srcHeight == 0:
+		return width, height
+	case width == 0:
+		return max(1, int(math.Round(float64(height)*float64(srcWidth)/float64(srcHeight)))), height
+	case height == 0:
+		return width, max(1, int(math.Round(float64(width)*float64(srcHeight)/float64(srcWidth))))
+	default:
+		return width, height
 	}
+}
 
-	resized := imaging.Resize(img, width, height, imaging.Lanczos)
+// Encode кодирует изображение в формате format. quality задает качество JPEG от 1 до 100,
+// 0 - качество по умолчанию.
+func Encode(ctx context.Context, img image.Image, format string, quality int) ([]byte, error) {
 	// Создаем буфер для сохранения результата
 	var buf bytes.Buffer
-	// Кодируем изображение в исходном формате
+	var err error
 	switch format {
 	case "jpeg":
-		err = jpeg.Encode(&buf, resized, nil)
+		var opts *jpeg.Options
+		if quality > 0 {
+			opts = &jpeg.Options{Quality: quality}
+		}
+		err = jpeg.Encode(&buf, img, opts)
 	case "png":
-		err = png.Encode(&buf, resized)
+		err = png.Encode(&buf, img)
 	case "gif":
-		err = gif.Encode(&buf, resized, nil)
+		err = gif.Encode(&buf, img, nil)
 	default:
-		return nil, "", fmt.Errorf("unsupported image format: %s", format)
+		return nil, fmt.Errorf("%w: unsupported image format: %s", ErrNotImage, format)
 	}
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
-
-	return buf.Bytes(), format, nil
+	logger.FromContext(ctx).Debug("Encoded image", zap.String("format", format), zap.Int("bytes", buf.Len()))
+	return buf.Bytes(), nil
 }
@@ -0,0 +1,165 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrQueueFull возвращается, когда очередь ожидания заполнена и запрос нужно отклонить.
+var ErrQueueFull = errors.New("resize queue is full")
+
+type waiter struct {
+	pixels  int64
+	charged int64 // сколько пикселей занято из бюджета, заполняется при допуске
+	ready   chan struct{}
+}
+
+// Stats - текущая загрузка ограничителя.
+type Stats struct {
+	Running int
+	Queued  int
+	Pixels  int64
+}
+
+// Limiter ограничивает число одновременно выполняемых задач и суммарное число пикселей
+// обрабатываемых изображений. Задачи сверх лимита ждут в очереди ограниченной длины
+// в порядке поступления.
+type Limiter struct {
+	maxConcurrency int
+	maxQueue       int
+	maxPixels      int64
+
+	mu      sync.Mutex
+	running int
+	pixels  int64
+	queue   []*waiter
+}
+
+// New создает ограничитель. Нулевой maxConcurrency или maxPixels снимает соответствующее ограничение.
+func New(maxConcurrency, maxQueue int, maxPixels int64) *Limiter {
+	return &Limiter{
+		maxConcurrency: maxConcurrency,
+		maxQueue:       maxQueue,
+		maxPixels:      maxPixels,
+	}
+}
+
+// Acquire занимает место для задачи над изображением из pixels пикселей. Если места нет,
+// задача ждет в очереди; если очередь заполнена, сразу возвращается ErrQueueFull.
+// После завершения задачи нужно вызвать release.
+func (l *Limiter) Acquire(ctx context.Context, pixels int64) (release func(), err error) {
+	l.mu.Lock()
+	if len(l.queue) == 0 && l.fits(pixels) {
+		charged := l.admit(pixels)
+		l.mu.Unlock()
+		return func() { l.release(charged) }, nil
+	}
+	if len(l.queue) >= l.maxQueue {
+		l.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+	w := &waiter{pixels: pixels, ready: make(chan struct{})}
+	l.queue = append(l.queue, w)
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return func() { l.release(w.charged) }, nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		select {
+		case <-w.ready:
+			// Место освободилось одновременно с отменой - возвращаем его
+			l.running--
+			l.pixels -= w.charged
+			l.wakeUp()
+		default:
+			l.removeWaiter(w)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// SetLimits меняет ограничения во время работы. Уже выполняемые задачи продолжаются, а ожидающие
+// в очереди сразу получают место, если новые ограничения это позволяют. Задачи сверх новой длины
+// очереди остаются в ней.
+func (l *Limiter) SetLimits(maxConcurrency, maxQueue int, maxPixels int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxConcurrency = maxConcurrency
+	l.maxQueue = maxQueue
+	l.maxPixels = maxPixels
+	l.wakeUp()
+}
+
+// Stats возвращает текущую загрузку.
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Stats{Running: l.running, Queued: len(l.queue), Pixels: l.pixels}
+}
+
+// Saturated сообщает, что новая задача была бы сразу отклонена с ErrQueueFull.
+func (l *Limiter) Saturated() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	canAdmit := len(l.queue) == 0 && l.fits(1)
+	return !canAdmit && len(l.queue) >= l.maxQueue
+}
+
+func (l *Limiter) release(pixels int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running--
+	l.pixels -= pixels
+	l.wakeUp()
+}
+
+// wakeUp пропускает задачи из начала очереди, пока для них есть место.
+// Задачи не обгоняют друг друга, поэтому большие изображения не голодают. Вызывается под блокировкой.
+func (l *Limiter) wakeUp() {
+	for len(l.queue) > 0 && l.fits(l.queue[0].pixels) {
+		w := l.queue[0]
+		l.queue = l.queue[1:]
+		w.charged = l.admit(w.pixels)
+		close(w.ready)
+	}
+}
+
+func (l *Limiter) fits(pixels int64) bool {
+	if l.maxConcurrency > 0 && l.running >= l.maxConcurrency {
+		return false
+	}
+	return l.maxPixels == 0 || l.pixels+l.charge(pixels) <= l.maxPixels
+}
+
+// charge возвращает, сколько пикселей задача займет из бюджета. Изображение больше всего бюджета
+// обрабатывается, когда других задач нет. Считается по текущему лимиту, так как он мог уменьшиться,
+// пока задача ждала в очереди.
+func (l *Limiter) charge(pixels int64) int64 {
+	if l.maxPixels > 0 {
+		return min(pixels, l.maxPixels)
+	}
+	return pixels
+}
+
+// admit занимает место для задачи и возвращает занятое число пикселей.
+func (l *Limiter) admit(pixels int64) int64 {
+	charged := l.charge(pixels)
+	l.running++
+	l.pixels += charged
+	return charged
+}
+
+func (l *Limiter) removeWaiter(w *waiter) {
+	for i, queued := range l.queue {
+		if queued == w {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			break
+		}
+	}
+	// Ушедшая из головы очереди задача могла блокировать следующие
+	l.wakeUp()
+}
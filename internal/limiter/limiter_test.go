@@ -0,0 +1,136 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require" //nolint:depguard
+)
+
+func TestLimiter_concurrency(t *testing.T) {
+	l := New(2, 1, 0)
+
+	release1, err := l.Acquire(context.Background(), 100)
+	require.NoError(t, err)
+	release2, err := l.Acquire(context.Background(), 100)
+	require.NoError(t, err)
+	// Места заняты, но в очереди еще есть место
+	require.False(t, l.Saturated())
+
+	// Третья задача ждет в очереди
+	acquired := make(chan func())
+	go func() {
+		release, err := l.Acquire(context.Background(), 100)
+		if err != nil {
+			release = nil
+		}
+		acquired <- release
+	}()
+	require.Eventually(t, func() bool { return l.Stats().Queued == 1 }, time.Second, time.Millisecond)
+
+	// Очередь заполнена - четвертая задача отклоняется сразу
+	require.True(t, l.Saturated())
+	_, err = l.Acquire(context.Background(), 100)
+	require.ErrorIs(t, err, ErrQueueFull)
+
+	release1()
+	release3 := <-acquired
+	require.NotNil(t, release3)
+	require.Equal(t, Stats{Running: 2, Pixels: 200}, l.Stats())
+
+	release2()
+	release3()
+	require.Equal(t, Stats{}, l.Stats())
+}
+
+func TestLimiter_pixels(t *testing.T) {
+	l := New(0, 10, 1000)
+
+	release1, err := l.Acquire(context.Background(), 600)
+	require.NoError(t, err)
+
+	// Изображение не помещается в оставшийся бюджет
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = l.Acquire(ctx, 600)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, 0, l.Stats().Queued)
+
+	// Небольшое изображение помещается
+	release2, err := l.Acquire(context.Background(), 400)
+	require.NoError(t, err)
+	release1()
+	release2()
+
+	// Изображение больше всего бюджета обрабатывается в одиночку
+	release3, err := l.Acquire(context.Background(), 5000)
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), l.Stats().Pixels)
+	release3()
+	require.Equal(t, Stats{}, l.Stats())
+}
+
+func TestLimiter_SetLimits(t *testing.T) {
+	l := New(1, 1, 0)
+
+	release1, err := l.Acquire(context.Background(), 100)
+	require.NoError(t, err)
+
+	acquired := make(chan func())
+	go func() {
+		release, err := l.Acquire(context.Background(), 100)
+		if err != nil {
+			release = nil
+		}
+		acquired <- release
+	}()
+	require.Eventually(t, func() bool { return l.Stats().Queued == 1 }, time.Second, time.Millisecond)
+
+	// Увеличение лимита сразу пропускает задачу из очереди
+	l.SetLimits(2, 1, 0)
+	release2 := <-acquired
+	require.NotNil(t, release2)
+	require.Equal(t, Stats{Running: 2, Pixels: 200}, l.Stats())
+
+	// После уменьшения лимита новые задачи ждут, пока не завершатся лишние
+	l.SetLimits(1, 0, 0)
+	_, err = l.Acquire(context.Background(), 100)
+	require.ErrorIs(t, err, ErrQueueFull)
+
+	release1()
+	release2()
+	require.Equal(t, Stats{}, l.Stats())
+}
+
+func TestLimiter_SetLimits_pixels(t *testing.T) {
+	l := New(0, 2, 1000)
+
+	release1, err := l.Acquire(context.Background(), 600)
+	require.NoError(t, err)
+
+	acquired := make(chan func(), 2)
+	for range 2 {
+		go func() {
+			release, err := l.Acquire(context.Background(), 900)
+			if err != nil {
+				release = nil
+			}
+			acquired <- release
+		}()
+	}
+	require.Eventually(t, func() bool { return l.Stats().Queued == 2 }, time.Second, time.Millisecond)
+
+	// Задача больше уменьшенного бюджета пропускается в одиночку, а не блокирует очередь
+	l.SetLimits(0, 2, 500)
+	release1()
+	release2 := <-acquired
+	require.NotNil(t, release2)
+	require.Equal(t, Stats{Running: 1, Queued: 1, Pixels: 500}, l.Stats())
+
+	release2()
+	release3 := <-acquired
+	require.NotNil(t, release3)
+	release3()
+	require.Equal(t, Stats{}, l.Stats())
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus" //nolint:depguard
+	"resizer/internal/cache"                         //nolint:depguard
+	"resizer/internal/upstream"                      //nolint:depguard
+)
+
+// cacheCollector снимает статистику кэша в момент чтения метрик.
+type cacheCollector struct {
+	cache cache.Cache
+
+	hits      *prometheus.Desc
+	misses    *prometheus.Desc
+	evictions *prometheus.Desc
+	entries   *prometheus.Desc
+	bytes     *prometheus.Desc
+}
+
+func newCacheCollector(name string, c cache.Cache) *cacheCollector {
+	desc := func(metric, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "cache", metric),
+			help,
+			[]string{"tier"},
+			prometheus.Labels{"cache": name},
+		)
+	}
+	return &cacheCollector{
+		cache:     c,
+		hits:      desc("hits_total", "Cache hits by tier."),
+		misses:    desc("misses_total", "Cache misses by tier."),
+		evictions: desc("evictions_total", "Entries evicted to make room, by tier."),
+		entries:   desc("entries", "Entries stored, by tier."),
+		bytes:     desc("bytes", "Bytes stored, by tier."),
+	}
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.cache.Stats()
+	for tier, s := range map[string]cache.TierStats{"memory": stats.Memory, "disk": stats.Disk} {
+		ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(s.Hits), tier)
+		ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(s.Misses), tier)
+		ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(s.Evictions), tier)
+		ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(s.Entries), tier)
+		ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.GaugeValue, float64(s.Bytes), tier)
+	}
+}
+
+// breakerCollector отдает состояния автоматов источников с недавними ошибками:
+// 0 - замкнут, 1 - разомкнут, 2 - пропускает пробный запрос. Для хостов, сведенных к "other",
+// отдается худшее из их состояний.
+type breakerCollector struct {
+	fetcher   *upstream.Fetcher
+	hostLabel func(host string) string
+}
+
+var breakerStateDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "origin", "circuit_state"),
+	"Circuit breaker state of origin hosts with recent failures: 0 - closed, 1 - open, 2 - half-open.",
+	[]string{"host"},
+	nil,
+)
+
+func (c *breakerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- breakerStateDesc
+}
+
+func (c *breakerCollector) Collect(ch chan<- prometheus.Metric) {
+	states := make(map[string]upstream.BreakerState)
+	for host, state := range c.fetcher.Breakers() {
+		host = c.hostLabel(host)
+		if prev, found := states[host]; !found || severity(state) > severity(prev) {
+			states[host] = state
+		}
+	}
+	for host, state := range states {
+		ch <- prometheus.MustNewConstMetric(breakerStateDesc, prometheus.GaugeValue, float64(state), host)
+	}
+}
+
+// severity упорядочивает состояния автомата: разомкнутый хуже пропускающего пробный запрос.
+func severity(state upstream.BreakerState) int {
+	switch state {
+	case upstream.BreakerOpen:
+		return 2
+	case upstream.BreakerHalfOpen:
+		return 1
+	default:
+		return 0
+	}
+}
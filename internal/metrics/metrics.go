@@ -0,0 +1,244 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"            //nolint:depguard
+	"github.com/prometheus/client_golang/prometheus/collectors" //nolint:depguard
+	"github.com/prometheus/client_golang/prometheus/promhttp"   //nolint:depguard
+	"resizer/internal/cache"                                    //nolint:depguard
+	"resizer/internal/limiter"                                  //nolint:depguard
+	"resizer/internal/upstream"                                 //nolint:depguard
+)
+
+const namespace = "resizer"
+
+// otherHost заменяет в метках хосты источников, которых нет в WithHosts.
+const otherHost = "other"
+
+// Стадии обработки изображения для ObserveStage.
+const (
+	StageDecode = "decode"
+	StageResize = "resize"
+	StageEncode = "encode"
+)
+
+// Metrics собирает метрики сервиса в собственном реестре Prometheus.
+// Методы безопасно вызывать у nil: тогда метрики не собираются.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	requestsInFlight prometheus.Gauge
+
+	fetchDuration   *prometheus.HistogramVec
+	fetchErrors     *prometheus.CounterVec
+	fetchesInFlight prometheus.Gauge
+
+	stageDuration *prometheus.HistogramVec
+
+	hosts map[string]bool // хосты источников с собственным значением метки host
+}
+
+// Option настраивает Metrics.
+type Option func(*Metrics)
+
+// WithHosts задает хосты источников, которые получают в метке host собственное значение.
+// Хосты берутся из адресов, которые присылают клиенты, поэтому остальные сводятся к "other",
+// иначе число рядов метрик не ограничено.
+func WithHosts(hosts ...string) Option {
+	return func(m *Metrics) {
+		for _, host := range hosts {
+			m.hosts[host] = true
+		}
+	}
+}
+
+// New создает метрики и регистрирует их вместе со стандартными метриками Go и процесса.
+func New(opts ...Option) *Metrics {
+	m := &Metrics{
+		hosts:    make(map[string]bool),
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by handler mode and response status.",
+		}, []string{"mode", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by handler mode and response status.",
+			Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+		}, []string{"mode", "status"}),
+		requestsInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "HTTP requests being served.",
+		}),
+		fetchDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "origin_fetch_duration_seconds",
+			Help:      "Duration of source image download attempts by origin host.",
+			Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, []string{"host"}),
+		fetchErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "origin_fetch_errors_total",
+			Help:      "Failed source image download attempts by origin host and reason.",
+		}, []string{"host", "reason"}),
+		fetchesInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "origin_fetches_in_flight",
+			Help:      "Source image downloads in progress.",
+		}),
+		stageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "image_stage_duration_seconds",
+			Help:      "Duration of image processing stages: decode, resize, encode.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"stage"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.requestDuration, m.requestsInFlight,
+		m.fetchDuration, m.fetchErrors, m.fetchesInFlight,
+		m.stageDuration,
+	)
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Handler отдает метрики в текстовом формате Prometheus.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Instrument считает запросы к next, их длительность и статусы ответов с меткой mode.
+func (m *Metrics) Instrument(mode string, next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.requestsInFlight.Inc()
+		defer m.requestsInFlight.Dec()
+
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		status := strconv.Itoa(sw.status)
+		m.requests.WithLabelValues(mode, status).Inc()
+		m.requestDuration.WithLabelValues(mode, status).Observe(time.Since(start).Seconds())
+	})
+}
+
+// ObserveStage учитывает длительность стадии обработки изображения.
+func (m *Metrics) ObserveStage(stage string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.stageDuration.WithLabelValues(stage).Observe(d.Seconds())
+}
+
+// FetchStarted реализует upstream.Observer.
+func (m *Metrics) FetchStarted(string) {
+	if m == nil {
+		return
+	}
+	m.fetchesInFlight.Inc()
+}
+
+// FetchFinished реализует upstream.Observer.
+func (m *Metrics) FetchFinished(host string, d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.fetchesInFlight.Dec()
+	host = m.hostLabel(host)
+	m.fetchDuration.WithLabelValues(host).Observe(d.Seconds())
+	if err != nil {
+		m.fetchErrors.WithLabelValues(host, errorReason(err)).Inc()
+	}
+}
+
+// hostLabel возвращает значение метки host для хоста источника.
+func (m *Metrics) hostLabel(host string) string {
+	if m.hosts[host] {
+		return host
+	}
+	return otherHost
+}
+
+// RegisterCache добавляет статистику кэша с меткой cache=name.
+func (m *Metrics) RegisterCache(name string, c cache.Cache) {
+	m.registry.MustRegister(newCacheCollector(name, c))
+}
+
+// RegisterLimiter добавляет загрузку ограничителя ресайза.
+func (m *Metrics) RegisterLimiter(l *limiter.Limiter) {
+	gauge := func(name, help string, value func(limiter.Stats) float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return value(l.Stats()) })
+	}
+	m.registry.MustRegister(
+		gauge("resizes_in_flight", "Resizes being processed.",
+			func(s limiter.Stats) float64 { return float64(s.Running) }),
+		gauge("resizes_queued", "Resizes waiting for a free slot.",
+			func(s limiter.Stats) float64 { return float64(s.Queued) }),
+		gauge("resize_pixels_in_flight", "Source pixels being decoded.",
+			func(s limiter.Stats) float64 { return float64(s.Pixels) }),
+	)
+}
+
+// RegisterBreakers добавляет состояния автоматов источников.
+func (m *Metrics) RegisterBreakers(f *upstream.Fetcher) {
+	m.registry.MustRegister(&breakerCollector{fetcher: f, hostLabel: m.hostLabel})
+}
+
+// errorReason сводит ошибку загрузки к короткой причине для метки.
+func errorReason(err error) string {
+	var statusErr *upstream.StatusError
+	switch {
+	case errors.As(err, &statusErr):
+		return "status_" + strconv.Itoa(statusErr.StatusCode)
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, upstream.ErrTooManyRedirects):
+		return "redirects"
+	default:
+		return "network"
+	}
+}
+
+// statusWriter запоминает статус ответа.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
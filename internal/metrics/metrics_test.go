@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil" //nolint:depguard
+	"github.com/stretchr/testify/require"                     //nolint:depguard
+	"resizer/internal/cache"                                  //nolint:depguard
+	"resizer/internal/upstream"                               //nolint:depguard
+)
+
+func TestMetrics_instrument(t *testing.T) {
+	m := New()
+	handler := m.Instrument("resize", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("image"))
+	}))
+
+	for _, path := range []string{"/image", "/image", "/missing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	require.InDelta(t, 2, testutil.ToFloat64(m.requests.WithLabelValues("resize", "200")), 0)
+	require.InDelta(t, 1, testutil.ToFloat64(m.requests.WithLabelValues("resize", "404")), 0)
+	require.InDelta(t, 0, testutil.ToFloat64(m.requestsInFlight), 0)
+}
+
+func TestMetrics_fetches(t *testing.T) {
+	m := New(WithHosts("origin"))
+	m.FetchStarted("origin")
+	require.InDelta(t, 1, testutil.ToFloat64(m.fetchesInFlight), 0)
+	m.FetchFinished("origin", time.Millisecond, &upstream.StatusError{StatusCode: http.StatusBadGateway})
+	m.FetchStarted("origin")
+	m.FetchFinished("origin", time.Millisecond, context.DeadlineExceeded)
+
+	require.InDelta(t, 0, testutil.ToFloat64(m.fetchesInFlight), 0)
+	require.InDelta(t, 1, testutil.ToFloat64(m.fetchErrors.WithLabelValues("origin", "status_502")), 0)
+	require.InDelta(t, 1, testutil.ToFloat64(m.fetchErrors.WithLabelValues("origin", "timeout")), 0)
+
+	// Хосты не из списка сводятся к одному значению метки
+	for _, host := range []string{"a.example.com", "b.example.com"} {
+		m.FetchStarted(host)
+		m.FetchFinished(host, time.Millisecond, context.DeadlineExceeded)
+	}
+	require.InDelta(t, 2, testutil.ToFloat64(m.fetchErrors.WithLabelValues("other", "timeout")), 0)
+	require.Equal(t, 2, testutil.CollectAndCount(m.fetchDuration))
+}
+
+func TestMetrics_breakers(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(origin.Close)
+	f := upstream.New(upstream.WithCircuitBreaker(1, time.Hour, nil))
+	_, _, err := f.Fetch(context.Background(), origin.URL, nil)
+	require.Error(t, err)
+
+	m := New()
+	m.RegisterBreakers(f)
+	//nolint:lll // строка HELP не переносится
+	expected := `
+# HELP resizer_origin_circuit_state Circuit breaker state of origin hosts with recent failures: 0 - closed, 1 - open, 2 - half-open.
+# TYPE resizer_origin_circuit_state gauge
+resizer_origin_circuit_state{host="other"} 1
+`
+	require.NoError(t, testutil.GatherAndCompare(m.registry, strings.NewReader(expected), "resizer_origin_circuit_state"))
+}
+
+func TestMetrics_cache(t *testing.T) {
+	disk, err := cache.NewCache(10, t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, disk.Set("key1", []byte("value1")))
+	_, _ = disk.Get("key1")
+	_, _ = disk.Get("missing")
+
+	m := New()
+	m.RegisterCache("variants", disk)
+
+	expected := `
+# HELP resizer_cache_bytes Bytes stored, by tier.
+# TYPE resizer_cache_bytes gauge
+resizer_cache_bytes{cache="variants",tier="disk"} 6
+resizer_cache_bytes{cache="variants",tier="memory"} 0
+# HELP resizer_cache_hits_total Cache hits by tier.
+# TYPE resizer_cache_hits_total counter
+resizer_cache_hits_total{cache="variants",tier="disk"} 1
+resizer_cache_hits_total{cache="variants",tier="memory"} 0
+# HELP resizer_cache_misses_total Cache misses by tier.
+# TYPE resizer_cache_misses_total counter
+resizer_cache_misses_total{cache="variants",tier="disk"} 1
+resizer_cache_misses_total{cache="variants",tier="memory"} 0
+`
+	require.NoError(t, testutil.GatherAndCompare(m.registry, strings.NewReader(expected),
+		"resizer_cache_bytes", "resizer_cache_hits_total", "resizer_cache_misses_total"))
+
+	// Метрики отдаются в текстовом формате Prometheus
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `resizer_cache_entries{cache="variants",tier="disk"} 1`)
+}
@@ -0,0 +1,144 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrPanicked получают ожидающие вызывающие, если функция завершилась паникой.
+var ErrPanicked = errors.New("singleflight: function panicked")
+
+type call struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+	// dups - сколько вызывающих присоединилось к уже идущему вызову
+	dups int
+	// waiters - сколько вызывающих еще ждут результата; cancel отменяет контекст вызова,
+	// когда ждать перестают все. У вызовов через Do cancel не задан.
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// Group объединяет одновременные вызовы с одинаковым ключом: функция выполняется один раз,
+// а все вызывающие получают её результат и ошибку.
+type Group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// Do выполняет fn для ключа key, если для него нет выполняющегося вызова, иначе дожидается
+// результата уже идущего вызова. shared показывает, что результат получили несколько вызывающих.
+func (g *Group) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) { //nolint:revive
+	g.mu.Lock()
+	if c, ok := g.join(key); ok {
+		g.mu.Unlock()
+		<-c.done
+		return c.val, c.err, true
+	}
+	c := g.start(key, nil)
+	g.mu.Unlock()
+
+	defer g.finish(key, c)
+	// Если fn запаникует, ожидающие получат ErrPanicked, а паника продолжится у вызвавшего
+	c.err = ErrPanicked
+	c.val, c.err = fn()
+
+	g.mu.Lock()
+	shared = c.dups > 0
+	g.mu.Unlock()
+	return c.val, c.err, shared
+}
+
+// DoContext работает как Do, но fn получает собственный контекст, который отменяется, только
+// когда результата перестали ждать все вызывающие. Вызывающий, чей ctx отменен, сразу получает
+// ctx.Err(), не дожидаясь fn. Значения ctx первого вызывающего доступны в контексте fn.
+//
+// fn выполняется в отдельной горутине, поэтому её паника не передается вызывающим,
+// а превращается в ошибку ErrPanicked.
+func (g *Group) DoContext(
+	ctx context.Context,
+	key string,
+	fn func(ctx context.Context) (interface{}, error),
+) (v interface{}, err error, shared bool) { //nolint:revive
+	g.mu.Lock()
+	if c, ok := g.join(key); ok {
+		g.mu.Unlock()
+		return g.wait(ctx, key, c, true)
+	}
+	callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	c := g.start(key, cancel)
+	g.mu.Unlock()
+
+	go func() {
+		defer g.finish(key, c)
+		defer func() {
+			if r := recover(); r != nil {
+				c.val, c.err = nil, fmt.Errorf("%w: %v", ErrPanicked, r)
+			}
+		}()
+		c.val, c.err = fn(callCtx)
+	}()
+	return g.wait(ctx, key, c, false)
+}
+
+// join присоединяет вызывающего к идущему вызову. Вызывается под блокировкой.
+func (g *Group) join(key string) (*call, bool) {
+	c, ok := g.calls[key]
+	if ok {
+		c.dups++
+		c.waiters++
+	}
+	return c, ok
+}
+
+// start регистрирует новый вызов. Вызывается под блокировкой.
+func (g *Group) start(key string, cancel context.CancelFunc) *call {
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	c := &call{done: make(chan struct{}), waiters: 1, cancel: cancel}
+	g.calls[key] = c
+	return c
+}
+
+// finish снимает вызов с регистрации и будит ожидающих.
+func (g *Group) finish(key string, c *call) {
+	g.mu.Lock()
+	g.forget(key, c)
+	g.mu.Unlock()
+	if c.cancel != nil {
+		c.cancel()
+	}
+	close(c.done)
+}
+
+// forget удаляет вызов, если ключ еще не занят новым вызовом. Вызывается под блокировкой.
+func (g *Group) forget(key string, c *call) {
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+}
+
+// wait дожидается результата вызова или отмены ctx. Последний ушедший вызывающий отменяет
+// вызов, а следующий вызов с тем же ключом запускает fn заново.
+func (g *Group) wait(ctx context.Context, key string, c *call, joined bool) (interface{}, error, bool) {
+	select {
+	case <-c.done:
+		g.mu.Lock()
+		shared := c.dups > 0
+		g.mu.Unlock()
+		return c.val, c.err, shared
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 && c.cancel != nil {
+			c.cancel()
+			g.forget(key, c)
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err(), joined
+	}
+}
@@ -0,0 +1,145 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require" //nolint:depguard
+)
+
+func TestGroup_Do(t *testing.T) {
+	var g Group
+	v, err, shared := g.Do("key", func() (interface{}, error) {
+		return "value", nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "value", v)
+	require.False(t, shared)
+}
+
+func TestGroup_DoDuplicates(t *testing.T) {
+	var g Group
+	var calls atomic.Int32
+	release := make(chan struct{})
+	errOrigin := errors.New("origin failed")
+
+	const waiters = 10
+	var started, wg sync.WaitGroup
+	started.Add(waiters)
+	wg.Add(waiters)
+	for i := 0; i < waiters; i++ {
+		go func() {
+			defer wg.Done()
+			started.Done()
+			v, err, shared := g.Do("key", func() (interface{}, error) {
+				calls.Add(1)
+				<-release
+				return "value", errOrigin
+			})
+			require.ErrorIs(t, err, errOrigin)
+			require.Equal(t, "value", v)
+			require.True(t, shared)
+		}()
+	}
+
+	started.Wait()
+	// Даем всем горутинам присоединиться к вызову
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	require.Equal(t, int32(1), calls.Load())
+
+	// После завершения вызова функция выполняется снова
+	_, _, shared := g.Do("key", func() (interface{}, error) {
+		calls.Add(1)
+		return nil, nil
+	})
+	require.False(t, shared)
+	require.Equal(t, int32(2), calls.Load())
+}
+
+func TestGroup_DoContextSurvivesLeavingWaiter(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	started := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		close(started)
+		select {
+		case <-release:
+			return "value", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// Первый вызывающий уходит, не дождавшись результата
+	leaving, cancel := context.WithCancel(context.Background())
+	leftCh := make(chan error, 1)
+	go func() {
+		_, err, _ := g.DoContext(leaving, "key", fn)
+		leftCh <- err
+	}()
+	<-started
+
+	resultCh := make(chan interface{}, 1)
+	go func() {
+		v, err, shared := g.DoContext(context.Background(), "key", fn)
+		require.NoError(t, err)
+		require.True(t, shared)
+		resultCh <- v
+	}()
+	// Даем второму вызывающему присоединиться
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	require.ErrorIs(t, <-leftCh, context.Canceled)
+
+	// Второй вызывающий еще ждет, поэтому вызов не отменен
+	close(release)
+	require.Equal(t, "value", <-resultCh)
+}
+
+func TestGroup_DoContextCancelsWhenAllWaitersLeave(t *testing.T) {
+	var g Group
+	cancelled := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err, _ := g.DoContext(ctx, "key", func(ctx context.Context) (interface{}, error) {
+			<-ctx.Done()
+			close(cancelled)
+			return nil, ctx.Err()
+		})
+		errCh <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	require.ErrorIs(t, <-errCh, context.Canceled)
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("call was not cancelled")
+	}
+
+	// Новый вызов не присоединяется к отмененному
+	v, err, _ := g.DoContext(context.Background(), "key", func(context.Context) (interface{}, error) {
+		return "fresh", nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "fresh", v)
+}
+
+func TestGroup_DoContextPanic(t *testing.T) {
+	var g Group
+	_, err, _ := g.DoContext(context.Background(), "key", func(context.Context) (interface{}, error) {
+		panic("boom")
+	})
+	require.ErrorIs(t, err, ErrPanicked)
+}
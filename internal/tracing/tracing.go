@@ -0,0 +1,167 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"                                        //nolint:depguard
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp" //nolint:depguard
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"           //nolint:depguard
+	"go.opentelemetry.io/otel/propagation"                            //nolint:depguard
+	"go.opentelemetry.io/otel/sdk/resource"                           //nolint:depguard
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"                     //nolint:depguard
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"                //nolint:depguard
+)
+
+// Экспортеры трассировки.
+const (
+	// ExporterNone отключает трассировку.
+	ExporterNone = ""
+	// ExporterOTLP отправляет трассы коллектору по OTLP/HTTP.
+	ExporterOTLP = "otlp"
+	// ExporterStdout пишет трассы в стандартный вывод в формате JSON.
+	ExporterStdout = "stdout"
+	// ExporterFile пишет трассы в файл в формате JSON.
+	ExporterFile = "file"
+)
+
+// ErrUnknownExporter возвращается для неизвестного экспортера.
+var ErrUnknownExporter = errors.New("unknown tracing exporter")
+
+// Option настраивает трассировку.
+type Option func(*options)
+
+type options struct {
+	serviceName    string
+	serviceVersion string
+	endpoint       string
+	insecure       bool
+	file           string
+	sampleRatio    float64
+}
+
+// WithService задает имя и версию сервиса в трассах.
+func WithService(name, version string) Option {
+	return func(o *options) {
+		o.serviceName = name
+		o.serviceVersion = version
+	}
+}
+
+// WithEndpoint задает адрес коллектора OTLP (host:port). По умолчанию используется
+// OTEL_EXPORTER_OTLP_ENDPOINT или localhost:4318.
+func WithEndpoint(endpoint string, insecure bool) Option {
+	return func(o *options) {
+		o.endpoint = endpoint
+		o.insecure = insecure
+	}
+}
+
+// WithFile задает файл, в который пишет экспортер ExporterFile.
+func WithFile(path string) Option {
+	return func(o *options) {
+		o.file = path
+	}
+}
+
+// WithSampleRatio задает долю записываемых трасс, начатых сервисом. Трассы, начатые
+// вызывающей стороной, записываются по ее решению.
+func WithSampleRatio(ratio float64) Option {
+	return func(o *options) {
+		o.sampleRatio = ratio
+	}
+}
+
+// Provider владеет экспортером трасс.
+type Provider struct {
+	tp     *sdktrace.TracerProvider
+	output io.Closer // файл экспортера ExporterFile
+}
+
+// New настраивает глобальный провайдер трассировки OpenTelemetry и распространение контекста
+// в заголовках traceparent и baggage. С ExporterNone трассы не записываются и Provider ничего не делает.
+func New(exporter string, opts ...Option) (*Provider, error) {
+	o := options{serviceName: "resizer", sampleRatio: 1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var (
+		spanExporter sdktrace.SpanExporter
+		output       io.Closer
+		err          error
+	)
+	switch exporter {
+	case ExporterNone:
+		return &Provider{}, nil
+	case ExporterOTLP:
+		httpOpts := []otlptracehttp.Option{}
+		if o.endpoint != "" {
+			httpOpts = append(httpOpts, otlptracehttp.WithEndpoint(o.endpoint))
+		}
+		if o.insecure {
+			httpOpts = append(httpOpts, otlptracehttp.WithInsecure())
+		}
+		spanExporter, err = otlptracehttp.New(context.Background(), httpOpts...)
+	case ExporterStdout:
+		spanExporter, err = stdouttrace.New()
+	case ExporterFile:
+		var f *os.File
+		f, err = os.OpenFile(o.file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open traces file: %w", err)
+		}
+		output = f
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownExporter, exporter)
+	}
+	if err != nil {
+		closeOutput(output)
+		return nil, fmt.Errorf("failed to create tracing exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(o.serviceName),
+		semconv.ServiceVersion(o.serviceVersion),
+	))
+	if err != nil {
+		closeOutput(output)
+		return nil, fmt.Errorf("failed to create tracing resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(o.sampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	return &Provider{tp: tp, output: output}, nil
+}
+
+// closeOutput закрывает файл экспортера, если настроить трассировку не удалось.
+func closeOutput(output io.Closer) {
+	if output != nil {
+		_ = output.Close()
+	}
+}
+
+// Shutdown отправляет накопленные трассы и закрывает экспортер.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	if p.tp == nil {
+		return nil
+	}
+	err := p.tp.Shutdown(ctx)
+	if p.output != nil {
+		err = errors.Join(err, p.output.Close())
+	}
+	return err
+}
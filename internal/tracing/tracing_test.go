@@ -0,0 +1,44 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require" //nolint:depguard
+	"go.opentelemetry.io/otel"            //nolint:depguard
+)
+
+func TestNew_fileExporter(t *testing.T) {
+	// New заменяет глобальные провайдер и распространение контекста, после теста возвращаем прежние
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	path := filepath.Join(t.TempDir(), "traces.json")
+	p, err := New(ExporterFile, WithFile(path), WithService("resizer-test", "1.2.3"))
+	require.NoError(t, err)
+
+	_, span := otel.Tracer("test").Start(context.Background(), "test-span")
+	span.End()
+	require.NoError(t, p.Shutdown(context.Background()))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"Name":"test-span"`)
+	require.Contains(t, string(data), `"resizer-test"`)
+}
+
+func TestNew_disabled(t *testing.T) {
+	p, err := New(ExporterNone)
+	require.NoError(t, err)
+	require.NoError(t, p.Shutdown(context.Background()))
+}
+
+func TestNew_unknownExporter(t *testing.T) {
+	_, err := New("jaeger")
+	require.ErrorIs(t, err, ErrUnknownExporter)
+}
@@ -0,0 +1,182 @@
+package upstream
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen возвращается без обращения к источнику, пока его автомат разомкнут.
+var ErrCircuitOpen = errors.New("origin circuit breaker is open")
+
+// BreakerState - состояние автомата источника.
+type BreakerState int
+
+const (
+	// BreakerClosed - запросы к источнику выполняются как обычно.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen - источник недавно подряд отвечал ошибками, запросы к нему сразу завершаются ошибкой.
+	BreakerOpen
+	// BreakerHalfOpen - время ожидания истекло, к источнику пропускается один пробный запрос.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// StateHook вызывается при каждом переключении автомата источника host.
+type StateHook func(host string, from, to BreakerState)
+
+// maxBreakers ограничивает число хранимых автоматов, чтобы адреса с множеством разных
+// недоступных хостов не занимали память без предела.
+const maxBreakers = 10_000
+
+type breaker struct {
+	state    BreakerState
+	failures int // ошибок подряд
+	openedAt time.Time
+	failedAt time.Time // время последней ошибки
+}
+
+// breakers хранит автоматы по хостам источников. Хосты без недавних ошибок не хранятся.
+type breakers struct {
+	threshold int
+	cooldown  time.Duration
+	onChange  StateHook
+	now       func() time.Time
+	maxHosts  int
+
+	mu    sync.Mutex
+	hosts map[string]*breaker
+}
+
+func newBreakers(threshold int, cooldown time.Duration, onChange StateHook) *breakers {
+	return &breakers{
+		threshold: threshold,
+		cooldown:  cooldown,
+		onChange:  onChange,
+		now:       time.Now,
+		maxHosts:  maxBreakers,
+		hosts:     make(map[string]*breaker),
+	}
+}
+
+// allow проверяет, можно ли обратиться к источнику. После истечения cooldown разомкнутый
+// автомат пропускает один пробный запрос.
+func (b *breakers) allow(host string) error {
+	if b.threshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	br, found := b.hosts[host]
+	if !found || br.state == BreakerClosed {
+		b.mu.Unlock()
+		return nil
+	}
+	if br.state == BreakerOpen && b.now().Sub(br.openedAt) >= b.cooldown {
+		br.state = BreakerHalfOpen
+		b.mu.Unlock()
+		b.notify(host, BreakerOpen, BreakerHalfOpen)
+		return nil
+	}
+	b.mu.Unlock()
+	return ErrCircuitOpen
+}
+
+// record учитывает результат загрузки из источника. Ответ 4xx означает, что источник работает.
+// Ошибки, в которых источник не виноват (например, клиент отменил запрос), состояние не меняют.
+func (b *breakers) record(host string, err error) {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	br := b.hosts[host]
+	from := BreakerClosed
+	if br != nil {
+		from = br.state
+	}
+
+	switch {
+	case err == nil || isClientError(err):
+		// Источник ответил - забываем о его ошибках
+		delete(b.hosts, host)
+	case isOriginFailure(err):
+		if br == nil {
+			b.makeRoom()
+			br = &breaker{}
+			b.hosts[host] = br
+		}
+		br.failures++
+		br.failedAt = b.now()
+		if br.state == BreakerHalfOpen || br.failures >= b.threshold {
+			br.state = BreakerOpen
+			br.openedAt = b.now()
+		}
+	case br != nil && br.state == BreakerHalfOpen:
+		// Пробный запрос ничего не показал - следующий станет новой пробой
+		br.state = BreakerOpen
+	}
+
+	to := BreakerClosed
+	if br, found := b.hosts[host]; found {
+		to = br.state
+	}
+	b.mu.Unlock()
+
+	if from != to {
+		b.notify(host, from, to)
+	}
+}
+
+// makeRoom освобождает место для нового автомата: забывает хосты, у которых дольше cooldown
+// не было ошибок, а если таких нет - хост с самой давней ошибкой. Вызывается под блокировкой.
+func (b *breakers) makeRoom() {
+	if len(b.hosts) < b.maxHosts {
+		return
+	}
+	var oldest string
+	for host, br := range b.hosts {
+		if br.state == BreakerHalfOpen {
+			// Пробный запрос еще выполняется
+			continue
+		}
+		if b.now().Sub(br.failedAt) >= b.cooldown {
+			delete(b.hosts, host)
+			continue
+		}
+		if oldest == "" || br.failedAt.Before(b.hosts[oldest].failedAt) {
+			oldest = host
+		}
+	}
+	if len(b.hosts) >= b.maxHosts && oldest != "" {
+		delete(b.hosts, oldest)
+	}
+}
+
+// states возвращает состояния автоматов источников, у которых были недавние ошибки.
+func (b *breakers) states() map[string]BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	states := make(map[string]BreakerState, len(b.hosts))
+	for host, br := range b.hosts {
+		states[host] = br.state
+	}
+	return states
+}
+
+func (b *breakers) notify(host string, from, to BreakerState) {
+	if b.onChange != nil {
+		b.onChange(host, from, to)
+	}
+}
@@ -0,0 +1,101 @@
+package upstream
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require" //nolint:depguard
+)
+
+func TestBreakers(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	var transitions []string
+	b := newBreakers(2, time.Minute, func(host string, from, to BreakerState) {
+		transitions = append(transitions, host+": "+from.String()+" -> "+to.String())
+	})
+	b.now = func() time.Time { return now }
+
+	unavailable := &StatusError{StatusCode: http.StatusServiceUnavailable}
+	notFound := &StatusError{StatusCode: http.StatusNotFound}
+
+	// 404 и отмена клиентом не говорят о неисправности источника
+	b.record("origin", notFound)
+	b.record("origin", context.Canceled)
+	b.record("origin", unavailable)
+	require.NoError(t, b.allow("origin"))
+	b.record("origin", unavailable)
+	require.ErrorIs(t, b.allow("origin"), ErrCircuitOpen)
+	// Автоматы других источников независимы
+	require.NoError(t, b.allow("other"))
+	require.Equal(t, map[string]BreakerState{"origin": BreakerOpen}, b.states())
+
+	// После cooldown пропускается один пробный запрос, и его ошибка снова размыкает автомат
+	now = now.Add(time.Minute)
+	require.NoError(t, b.allow("origin"))
+	require.ErrorIs(t, b.allow("origin"), ErrCircuitOpen)
+	b.record("origin", unavailable)
+	require.ErrorIs(t, b.allow("origin"), ErrCircuitOpen)
+
+	// Успешная проба замыкает автомат
+	now = now.Add(time.Minute)
+	require.NoError(t, b.allow("origin"))
+	b.record("origin", nil)
+	require.NoError(t, b.allow("origin"))
+	require.Empty(t, b.states())
+
+	require.Equal(t, []string{
+		"origin: closed -> open",
+		"origin: open -> half-open",
+		"origin: half-open -> open",
+		"origin: open -> half-open",
+		"origin: half-open -> closed",
+	}, transitions)
+}
+
+func TestBreakers_clientError(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	b := newBreakers(1, time.Minute, nil)
+	b.now = func() time.Time { return now }
+
+	b.record("origin", &StatusError{StatusCode: http.StatusBadGateway})
+	require.ErrorIs(t, b.allow("origin"), ErrCircuitOpen)
+
+	// Ответ 4xx на пробный запрос показывает, что источник работает
+	now = now.Add(time.Minute)
+	require.NoError(t, b.allow("origin"))
+	b.record("origin", &StatusError{StatusCode: http.StatusNotFound})
+	require.NoError(t, b.allow("origin"))
+	require.Empty(t, b.states())
+}
+
+func TestBreakers_bounded(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	b := newBreakers(1, time.Minute, nil)
+	b.now = func() time.Time { return now }
+	b.maxHosts = 2
+	unavailable := &StatusError{StatusCode: http.StatusServiceUnavailable}
+
+	b.record("a", unavailable)
+	now = now.Add(time.Second)
+	b.record("b", unavailable)
+
+	// Места нет - забывается хост с самой давней ошибкой
+	now = now.Add(time.Second)
+	b.record("c", unavailable)
+	require.Equal(t, map[string]BreakerState{"b": BreakerOpen, "c": BreakerOpen}, b.states())
+
+	// Хосты без ошибок дольше cooldown забываются все
+	now = now.Add(time.Minute)
+	b.record("d", unavailable)
+	require.Equal(t, map[string]BreakerState{"d": BreakerOpen}, b.states())
+}
+
+func TestBreakers_disabled(t *testing.T) {
+	b := newBreakers(0, time.Minute, nil)
+	for i := 0; i < 10; i++ {
+		b.record("origin", &StatusError{StatusCode: http.StatusBadGateway})
+	}
+	require.NoError(t, b.allow("origin"))
+}
@@ -0,0 +1,371 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp" //nolint:depguard
+	"go.opentelemetry.io/otel"                                      //nolint:depguard
+	"go.opentelemetry.io/otel/attribute"                            //nolint:depguard
+	"go.opentelemetry.io/otel/codes"                                //nolint:depguard
+	"go.opentelemetry.io/otel/trace"                                //nolint:depguard
+)
+
+var tracer = otel.Tracer("resizer/internal/upstream")
+
+// ErrTooManyRedirects возвращается, если источник перенаправил запрос больше допустимого числа раз.
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// StatusError - ошибка источника, ответившего статусом, отличным от 200 OK.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("failed to download image: status code %d", e.StatusCode)
+}
+
+// Option настраивает Fetcher.
+type Option func(*options)
+
+type options struct {
+	timeout             time.Duration
+	dialTimeout         time.Duration
+	tlsHandshakeTimeout time.Duration
+	keepAlive           time.Duration
+	maxIdleConnsPerHost int
+	maxRedirects        int
+	proxy               func(*http.Request) (*url.URL, error)
+	retries             int
+	backoff             time.Duration
+	maxBackoff          time.Duration
+	breakerThreshold    int
+	breakerCooldown     time.Duration
+	onBreakerChange     StateHook
+	observer            Observer
+}
+
+// Observer получает сведения о каждой попытке загрузки, например, для метрик.
+type Observer interface {
+	FetchStarted(host string)
+	FetchFinished(host string, duration time.Duration, err error)
+}
+
+// WithTimeout ограничивает загрузку целиком, от установки соединения до чтения тела ответа.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithDialTimeout ограничивает установку TCP-соединения.
+func WithDialTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.dialTimeout = d
+	}
+}
+
+// WithTLSHandshakeTimeout ограничивает TLS-рукопожатие.
+func WithTLSHandshakeTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.tlsHandshakeTimeout = d
+	}
+}
+
+// WithKeepAlive задает период TCP keep-alive для соединений с источниками.
+func WithKeepAlive(d time.Duration) Option {
+	return func(o *options) {
+		o.keepAlive = d
+	}
+}
+
+// WithMaxIdleConnsPerHost задает, сколько простаивающих соединений с одним источником держится открытыми.
+func WithMaxIdleConnsPerHost(n int) Option {
+	return func(o *options) {
+		o.maxIdleConnsPerHost = n
+	}
+}
+
+// WithMaxRedirects задает, сколько перенаправлений выполняется при загрузке. 0 - не следовать им.
+func WithMaxRedirects(n int) Option {
+	return func(o *options) {
+		o.maxRedirects = n
+	}
+}
+
+// WithProxy направляет запросы к источникам через HTTP-прокси. По умолчанию прокси берется
+// из переменных окружения HTTP_PROXY, HTTPS_PROXY и NO_PROXY.
+func WithProxy(proxyURL *url.URL) Option {
+	return func(o *options) {
+		o.proxy = http.ProxyURL(proxyURL)
+	}
+}
+
+// WithRetries задает, сколько раз повторяется загрузка после временной ошибки источника:
+// разрыва соединения или ответа 502, 503, 504. Паузы между попытками растут экспоненциально
+// от backoff до maxBackoff со случайным разбросом, чтобы повторы разных запросов не совпадали.
+func WithRetries(n int, backoff, maxBackoff time.Duration) Option {
+	return func(o *options) {
+		o.retries = n
+		o.backoff = backoff
+		o.maxBackoff = maxBackoff
+	}
+}
+
+// WithCircuitBreaker включает автомат для каждого хоста источника: после threshold ошибок подряд
+// запросы к хосту в течение cooldown завершаются ErrCircuitOpen без обращения к нему.
+// onChange, если задан, получает все переключения автоматов.
+func WithCircuitBreaker(threshold int, cooldown time.Duration, onChange StateHook) Option {
+	return func(o *options) {
+		o.breakerThreshold = threshold
+		o.breakerCooldown = cooldown
+		o.onBreakerChange = onChange
+	}
+}
+
+// WithObserver передает observer сведения о каждой попытке загрузки.
+func WithObserver(observer Observer) Option {
+	return func(o *options) {
+		o.observer = observer
+	}
+}
+
+// Fetcher загружает исходные изображения. Соединения с источниками переиспользуются
+// всеми запросами, поэтому Fetcher создается один раз на сервер.
+type Fetcher struct {
+	client     *http.Client
+	transport  *http.Transport
+	timeout    time.Duration
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	breakers   *breakers
+	observer   Observer
+}
+
+// New создает Fetcher с собственным пулом соединений.
+func New(opts ...Option) *Fetcher {
+	o := options{proxy: http.ProxyFromEnvironment}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	transport := &http.Transport{
+		Proxy: o.proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   o.dialTimeout,
+			KeepAlive: o.keepAlive,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   o.maxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   o.tlsHandshakeTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+	maxRedirects := o.maxRedirects
+	return &Fetcher{
+		client: &http.Client{
+			// Каждая попытка получает свой span, а контекст трассы передается источнику в traceparent
+			Transport: otelhttp.NewTransport(transport),
+			CheckRedirect: func(_ *http.Request, via []*http.Request) error {
+				if len(via) > maxRedirects {
+					return fmt.Errorf("%w: more than %d", ErrTooManyRedirects, maxRedirects)
+				}
+				return nil
+			},
+		},
+		transport:  transport,
+		timeout:    o.timeout,
+		retries:    o.retries,
+		backoff:    o.backoff,
+		maxBackoff: o.maxBackoff,
+		breakers:   newBreakers(o.breakerThreshold, o.breakerCooldown, o.onBreakerChange),
+		observer:   o.observer,
+	}
+}
+
+// Fetch загружает изображение и возвращает его вместе с заголовками ответа.
+// Загрузка прерывается при отмене ctx. Таймаут загрузки общий для всех попыток.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string, headers http.Header) ([]byte, http.Header, error) {
+	ctx, span := tracer.Start(ctx, "upstream.fetch", trace.WithAttributes(attribute.String("url.full", rawURL)))
+	defer span.End()
+
+	data, respHeader, attempts, err := f.fetchWithRetries(ctx, rawURL, headers)
+	span.SetAttributes(
+		attribute.Int("upstream.attempts", attempts),
+		attribute.Int("upstream.response.size", len(data)),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return data, respHeader, err
+}
+
+// fetchWithRetries загружает изображение, повторяя попытки после временных ошибок,
+// и возвращает число сделанных попыток.
+func (f *Fetcher) fetchWithRetries(
+	ctx context.Context, rawURL string, headers http.Header,
+) ([]byte, http.Header, int, error) {
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+	}
+
+	var host string
+	if u, err := url.Parse(rawURL); err == nil {
+		host = u.Host
+	}
+	if err := f.breakers.allow(host); err != nil {
+		return nil, nil, 0, fmt.Errorf("%w: %s", err, host)
+	}
+	// Автомат учитывает загрузку целиком: повторы одной загрузки - это одна ошибка, а не несколько
+	data, respHeader, attempts, err := f.retry(ctx, host, rawURL, headers)
+	f.breakers.record(host, err)
+	return data, respHeader, attempts, err
+}
+
+// retry выполняет попытки загрузки, пока они не закончатся или ошибка не окажется постоянной.
+func (f *Fetcher) retry(
+	ctx context.Context, host, rawURL string, headers http.Header,
+) ([]byte, http.Header, int, error) {
+	for attempt := 0; ; attempt++ {
+		data, respHeader, err := f.observe(host, func() ([]byte, http.Header, error) {
+			return f.fetch(ctx, rawURL, headers)
+		})
+		if err == nil || attempt >= f.retries || !isTransient(err) {
+			return data, respHeader, attempt + 1, err
+		}
+		if err := sleep(ctx, f.delay(attempt)); err != nil {
+			return nil, nil, attempt + 1, err
+		}
+	}
+}
+
+// delay возвращает паузу перед повтором: случайную величину до backoff*2^attempt, но не больше maxBackoff.
+func (f *Fetcher) delay(attempt int) time.Duration {
+	d := f.backoff << attempt
+	if d <= 0 || (f.maxBackoff > 0 && d > f.maxBackoff) {
+		d = f.maxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d)
+}
+
+// Breakers возвращает состояния автоматов источников, у которых были недавние ошибки.
+func (f *Fetcher) Breakers() map[string]BreakerState {
+	return f.breakers.states()
+}
+
+// observe выполняет попытку загрузки fetch, сообщая о ней observer.
+func (f *Fetcher) observe(host string, fetch func() ([]byte, http.Header, error)) ([]byte, http.Header, error) {
+	if f.observer == nil {
+		return fetch()
+	}
+	f.observer.FetchStarted(host)
+	start := time.Now()
+	data, respHeader, err := fetch()
+	f.observer.FetchFinished(host, time.Since(start), err)
+	return data, respHeader, err
+}
+
+// fetch выполняет одну попытку загрузки.
+func (f *Fetcher) fetch(ctx context.Context, url string, headers http.Header) ([]byte, http.Header, error) {
+	// Создаем новый HTTP-запрос с контекстом
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Копируем заголовки из исходного запроса
+	req.Header = headers.Clone()
+
+	// Выполняем запрос
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Гарантируем закрытие тела ответа. Непрочитанный остаток небольшого ответа с ошибкой
+	// вычитывается, чтобы соединение вернулось в пул.
+	defer func() {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+		_ = resp.Body.Close()
+	}()
+
+	// Проверяем статус ответа
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	// Читаем тело ответа
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, resp.Header, nil
+}
+
+// sleep ждет d или отмены ctx.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// isTransient проверяет, что ошибка временная и загрузку стоит повторить: соединение разорвано
+// или отвергнуто, либо источник или прокси перед ним ответили 502, 503, 504.
+func isTransient(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
+
+// isClientError проверяет, что источник ответил статусом 4xx: он работает, просто такого
+// изображения нет или к нему нет доступа.
+func isClientError(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode >= 400 && statusErr.StatusCode < 500
+}
+
+// isOriginFailure проверяет, что ошибка говорит о неисправности источника: кроме временных ошибок
+// это таймауты и сетевые ошибки. Отмена запроса клиентом и ответы вроде 404 источник не компрометируют.
+func isOriginFailure(err error) bool {
+	if isTransient(err) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && !errors.Is(err, context.Canceled)
+}
+
+// Close закрывает простаивающие соединения с источниками.
+func (f *Fetcher) Close() {
+	f.transport.CloseIdleConnections()
+}
@@ -0,0 +1,187 @@
+package upstream
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require" //nolint:depguard
+)
+
+func TestFetcher_fetch(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/image.png" {
+			http.NotFound(w, r)
+			return
+		}
+		// Заголовки исходного запроса доходят до источника
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte(r.Header.Get("X-Test")))
+	}))
+	defer origin.Close()
+
+	f := New()
+	defer f.Close()
+
+	headers := http.Header{"X-Test": []string{"value"}}
+	data, respHeader, err := f.Fetch(context.Background(), origin.URL+"/image.png", headers)
+	require.NoError(t, err)
+	require.Equal(t, "value", string(data))
+	require.Equal(t, "max-age=60", respHeader.Get("Cache-Control"))
+
+	_, _, err = f.Fetch(context.Background(), origin.URL+"/missing.png", nil)
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	require.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+}
+
+func TestFetcher_redirects(t *testing.T) {
+	var origin *httptest.Server
+	origin = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// /3 перенаправляет на /2, /2 - на /1, /1 - на /0, который отдает данные
+		n, _ := strconv.Atoi(r.URL.Path[1:])
+		if n > 0 {
+			http.Redirect(w, r, origin.URL+"/"+strconv.Itoa(n-1), http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte("image"))
+	}))
+	defer origin.Close()
+
+	data, _, err := New(WithMaxRedirects(3)).Fetch(context.Background(), origin.URL+"/3", nil)
+	require.NoError(t, err)
+	require.Equal(t, "image", string(data))
+
+	_, _, err = New(WithMaxRedirects(2)).Fetch(context.Background(), origin.URL+"/3", nil)
+	require.ErrorIs(t, err, ErrTooManyRedirects)
+
+	_, _, err = New().Fetch(context.Background(), origin.URL+"/1", nil)
+	require.ErrorIs(t, err, ErrTooManyRedirects)
+}
+
+func TestFetcher_timeout(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer origin.Close()
+
+	_, _, err := New(WithTimeout(50*time.Millisecond)).Fetch(context.Background(), origin.URL, nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestFetcher_proxy(t *testing.T) {
+	var proxied atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Прокси получает запрос с абсолютным адресом источника
+		proxied.Add(1)
+		_, _ = w.Write([]byte(r.URL.String()))
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+
+	data, _, err := New(WithProxy(proxyURL)).Fetch(context.Background(), "http://origin.example/image.png", nil)
+	require.NoError(t, err)
+	require.Equal(t, "http://origin.example/image.png", string(data))
+	require.Equal(t, int32(1), proxied.Load())
+}
+
+func TestFetcher_reusesConnections(t *testing.T) {
+	var conns atomic.Int32
+	origin := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("image"))
+	}))
+	origin.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	origin.Start()
+	defer origin.Close()
+
+	f := New(WithMaxIdleConnsPerHost(4))
+	for i := 0; i < 10; i++ {
+		_, _, err := f.Fetch(context.Background(), origin.URL, nil)
+		require.NoError(t, err)
+	}
+	require.Equal(t, int32(1), conns.Load())
+}
+
+// flakyOrigin отвечает status первые failures раз, а затем отдает изображение.
+func flakyOrigin(t *testing.T, status, failures int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var hits atomic.Int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if int(hits.Add(1)) <= failures {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		_, _ = w.Write([]byte("image"))
+	}))
+	t.Cleanup(origin.Close)
+	return origin, &hits
+}
+
+func TestFetcher_retries(t *testing.T) {
+	origin, hits := flakyOrigin(t, http.StatusServiceUnavailable, 2)
+	f := New(WithRetries(2, time.Millisecond, 10*time.Millisecond))
+
+	data, _, err := f.Fetch(context.Background(), origin.URL, nil)
+	require.NoError(t, err)
+	require.Equal(t, "image", string(data))
+	require.Equal(t, int32(3), hits.Load())
+
+	// Попытки кончились раньше, чем источник ожил
+	origin, hits = flakyOrigin(t, http.StatusBadGateway, 5)
+	_, _, err = f.Fetch(context.Background(), origin.URL, nil)
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	require.Equal(t, http.StatusBadGateway, statusErr.StatusCode)
+	require.Equal(t, int32(3), hits.Load())
+
+	// Постоянные ошибки не повторяются
+	origin, hits = flakyOrigin(t, http.StatusNotFound, 5)
+	_, _, err = f.Fetch(context.Background(), origin.URL, nil)
+	require.ErrorAs(t, err, &statusErr)
+	require.Equal(t, int32(1), hits.Load())
+}
+
+func TestFetcher_circuitBreaker(t *testing.T) {
+	origin, hits := flakyOrigin(t, http.StatusServiceUnavailable, 100)
+	f := New(WithCircuitBreaker(3, time.Hour, nil))
+
+	for i := 0; i < 3; i++ {
+		_, _, err := f.Fetch(context.Background(), origin.URL, nil)
+		require.Error(t, err)
+	}
+	// Разомкнутый автомат отвечает сразу, не обращаясь к источнику
+	_, _, err := f.Fetch(context.Background(), origin.URL, nil)
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	require.Equal(t, int32(3), hits.Load())
+	require.Len(t, f.Breakers(), 1)
+}
+
+func TestFetcher_circuitBreakerRetries(t *testing.T) {
+	origin, hits := flakyOrigin(t, http.StatusServiceUnavailable, 100)
+	f := New(WithRetries(2, time.Millisecond, time.Millisecond), WithCircuitBreaker(2, time.Hour, nil))
+
+	// Повторы одной загрузки считаются одной ошибкой
+	_, _, err := f.Fetch(context.Background(), origin.URL, nil)
+	require.Error(t, err)
+	require.Equal(t, int32(3), hits.Load())
+	require.Equal(t, BreakerClosed, f.Breakers()[strings.TrimPrefix(origin.URL, "http://")])
+
+	_, _, err = f.Fetch(context.Background(), origin.URL, nil)
+	require.NotErrorIs(t, err, ErrCircuitOpen)
+	_, _, err = f.Fetch(context.Background(), origin.URL, nil)
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	require.Equal(t, int32(6), hits.Load())
+}
@@ -0,0 +1,22 @@
+package logger
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+type contextKey struct{}
+
+// WithContext возвращает копию ctx с логгером logg, например, логгером запроса с его идентификатором.
+func WithContext(ctx context.Context, logg *zap.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logg)
+}
+
+// FromContext возвращает логгер, сохраненный в ctx, а если его нет - глобальный логгер zap.
+func FromContext(ctx context.Context) *zap.Logger {
+	if logg, ok := ctx.Value(contextKey{}).(*zap.Logger); ok {
+		return logg
+	}
+	return zap.L()
+}
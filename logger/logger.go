@@ -2,46 +2,127 @@ package logger
 
 import (
 	"fmt"
+	"os"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2" //nolint:depguard
 )
 
-// NewLogger создает новый экземпляр логгера.
-func NewLogger(level string, isDevelopment bool) (*zap.Logger, error) {
-	var logger *zap.Logger
-	var err error
+// Option настраивает логгер.
+type Option func(*options)
 
-	var zapLevel zapcore.Level
-	var config zap.Config
+type options struct {
+	initial, thereafter int
+	file                *lumberjack.Logger
+}
+
+// WithSampling ограничивает поток записей уровня info и ниже: каждую секунду из записей с одинаковыми
+// уровнем и сообщением пишутся первые initial, а затем каждая thereafter-я. Предупреждения и ошибки
+// пишутся всегда. thereafter = 0 отключает ограничение.
+func WithSampling(initial, thereafter int) Option {
+	return func(o *options) {
+		o.initial = initial
+		o.thereafter = thereafter
+	}
+}
+
+// WithFile дублирует журнал в файл path. Файл сменяется новым, когда его размер превышает
+// maxSize мегабайт; хранятся не больше maxBackups старых файлов не старше maxAge дней.
+func WithFile(path string, maxSize, maxBackups, maxAge int, compress bool) Option {
+	return func(o *options) {
+		o.file = &lumberjack.Logger{
+			Filename:   path,
+			MaxSize:    maxSize,
+			MaxBackups: maxBackups,
+			MaxAge:     maxAge,
+			Compress:   compress,
+		}
+	}
+}
+
+// ParseLevel разбирает уровень логирования из конфигурации.
+func ParseLevel(level string) (zapcore.Level, error) {
 	switch level {
 	case "error":
-		zapLevel = zapcore.ErrorLevel
+		return zapcore.ErrorLevel, nil
 	case "warn":
-		zapLevel = zapcore.WarnLevel
+		return zapcore.WarnLevel, nil
 	case "info":
-		zapLevel = zapcore.InfoLevel
+		return zapcore.InfoLevel, nil
 	case "debug":
-		zapLevel = zapcore.DebugLevel
+		return zapcore.DebugLevel, nil
 	default:
-		return nil, fmt.Errorf("unsupported log level: %s", level)
+		return 0, fmt.Errorf("unsupported log level: %s", level)
+	}
+}
+
+// NewLogger создает новый экземпляр логгера. Уровень level можно менять во время работы.
+func NewLogger(level zap.AtomicLevel, isDevelopment bool, opts ...Option) *zap.Logger {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
 	}
 
+	var encoder zapcore.Encoder
+	zapOpts := []zap.Option{zap.AddCaller(), zap.ErrorOutput(zapcore.Lock(os.Stderr))}
 	if isDevelopment {
 		// Development Logger: человекочитаемый формат
-		config = zap.NewDevelopmentConfig()
-		config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder // Цветной вывод уровней логов
+		encoderConfig := zap.NewDevelopmentEncoderConfig()
+		encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder // Цветной вывод уровней логов
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+		zapOpts = append(zapOpts, zap.Development(), zap.AddStacktrace(zapcore.WarnLevel))
 	} else {
 		// Production Logger: структурированный JSON
-		config = zap.NewProductionConfig()
+		encoder = zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+		zapOpts = append(zapOpts, zap.AddStacktrace(zapcore.ErrorLevel))
 	}
-	config.Level.SetLevel(zapLevel)
-	config.OutputPaths = []string{"stdout"}
-	config.ErrorOutputPaths = []string{"stderr"}
-	logger, err = config.Build()
-	if err != nil {
-		return nil, err
+
+	output := zapcore.Lock(os.Stdout)
+	if o.file != nil {
+		// Директория и сам файл создаются при первой записи
+		output = zapcore.NewMultiWriteSyncer(output, zapcore.AddSync(o.file))
 	}
 
-	return logger, nil
+	core := zapcore.NewCore(encoder, output, level)
+	if o.thereafter > 0 {
+		// Частые записи уровня info прореживаются, а предупреждения и ошибки пишутся все
+		verbose := zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+			return level.Enabled(l) && l < zapcore.WarnLevel
+		})
+		important := zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+			return level.Enabled(l) && l >= zapcore.WarnLevel
+		})
+		core = &sampledCore{
+			Core: zapcore.NewTee(
+				zapcore.NewSamplerWithOptions(zapcore.NewCore(encoder, output, verbose), time.Second, o.initial, o.thereafter),
+				zapcore.NewCore(encoder, output, important),
+			),
+			unsampled: core,
+		}
+	}
+
+	return zap.New(core, zapOpts...)
+}
+
+// Unsampled возвращает логгер, который пишет все записи без прореживания, например журнал доступа,
+// где каждая запись описывает отдельный запрос. Поля и настройки logg сохраняются.
+func Unsampled(logg *zap.Logger) *zap.Logger {
+	return logg.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		if sampled, ok := core.(*sampledCore); ok {
+			return sampled.unsampled
+		}
+		return core
+	}))
+}
+
+// sampledCore прореживает записи и хранит такое же ядро без прореживания для Unsampled.
+type sampledCore struct {
+	zapcore.Core
+	unsampled zapcore.Core
+}
+
+func (c *sampledCore) With(fields []zapcore.Field) zapcore.Core {
+	return &sampledCore{Core: c.Core.With(fields), unsampled: c.unsampled.With(fields)}
 }
@@ -0,0 +1,65 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require" //nolint:depguard
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestNewLogger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "resizer.log")
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	logg := NewLogger(level, false, WithSampling(2, 1000), WithFile(path, 1, 1, 1, false))
+
+	for i := 0; i < 10; i++ {
+		logg.Info("info")
+		logg.Warn("warn")
+	}
+	logg.Debug("debug")
+
+	// Уровень меняется без пересоздания логгера
+	level.SetLevel(zapcore.DebugLevel)
+	logg.Debug("debug")
+	_ = logg.Sync() // sync stdout fails when it is a pipe
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	log := string(data)
+	require.Equal(t, 2, strings.Count(log, `"msg":"info"`), "info entries are sampled")
+	require.Equal(t, 10, strings.Count(log, `"msg":"warn"`), "warnings are never sampled")
+	require.Equal(t, 1, strings.Count(log, `"msg":"debug"`))
+}
+
+func TestUnsampled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resizer.log")
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	logg := NewLogger(level, false, WithSampling(2, 1000), WithFile(path, 1, 1, 1, false))
+	access := Unsampled(logg.With(zap.String("requestId", "42")))
+
+	for i := 0; i < 10; i++ {
+		logg.Info("info")
+		access.Info("request")
+	}
+	access.Debug("request")
+	_ = logg.Sync()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	log := string(data)
+	require.Equal(t, 2, strings.Count(log, `"msg":"info"`))
+	require.Equal(t, 10, strings.Count(log, `"msg":"request","requestId":"42"`), "unsampled entries keep fields")
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("debug")
+	require.NoError(t, err)
+	require.Equal(t, zapcore.DebugLevel, level)
+
+	_, err = ParseLevel("verbose")
+	require.Error(t, err)
+}